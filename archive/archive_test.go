@@ -0,0 +1,229 @@
+package archive
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/billikeu/go-chatgpt/params"
+)
+
+func sampleConversation() *Conversation {
+	conv := NewConversation("Trip to Paris")
+	conv.CreateTime = time.Unix(1714557600, 0)
+	conv.UpdateTime = time.Unix(1714557900, 0)
+	conv.Add(&Message{Role: "system", Content: "You are a travel agent."})
+	conv.Add(&Message{Role: "user", Name: "bob", Content: "What is this?", Images: []string{"https://example.com/eiffel.png"}, CreateTime: time.Unix(1714557610, 0)})
+	conv.Add(&Message{Role: "assistant", Content: "The Eiffel tower.\n\nIt is 330 m high.", Model: "gpt-4o", FinishReason: "stop"})
+	conv.Add(&Message{Role: "user", Content: "Tell me more"})
+	conv.Add(&Message{Role: "assistant", Content: "It was built", Model: "gpt-4o", FinishReason: "length", Truncated: true})
+	conv.Add(&Message{Role: "user", Content: "Hello?"})
+	return conv
+}
+
+// the fields every format keeps
+type messageContent struct {
+	Role    string
+	Content string
+	Images  []string
+	Model   string
+}
+
+func contents(conv *Conversation) []messageContent {
+	var out []messageContent
+	for _, v := range conv.Messages {
+		out = append(out, messageContent{v.Role, v.Content, v.Images, v.Model})
+	}
+	return out
+}
+
+func TestExportRoundTrip(t *testing.T) {
+	conv := sampleConversation()
+	var buf bytes.Buffer
+	if err := WriteExport(&buf, conv, NewConversation("empty")); err != nil {
+		t.Fatal(err)
+	}
+	convs, err := ReadExport(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(convs) != 2 || len(convs[1].Messages) != 0 {
+		t.Fatalf("read %d conversations", len(convs))
+	}
+	got := convs[0]
+	if got.ID != conv.ID || got.Title != conv.Title || !got.CreateTime.Equal(conv.CreateTime) || !got.UpdateTime.Equal(conv.UpdateTime) {
+		t.Errorf("conversation = %+v, want %+v", got, conv)
+	}
+	if !reflect.DeepEqual(got.Messages, conv.Messages) {
+		for i := range conv.Messages {
+			if i < len(got.Messages) && !reflect.DeepEqual(got.Messages[i], conv.Messages[i]) {
+				t.Errorf("message %d = %+v, want %+v", i, got.Messages[i], conv.Messages[i])
+			}
+		}
+		if len(got.Messages) != len(conv.Messages) {
+			t.Errorf("read %d messages, want %d", len(got.Messages), len(conv.Messages))
+		}
+	}
+}
+
+func TestReadExportStopped(t *testing.T) {
+	conv := NewConversation("stopped")
+	conv.Add(&Message{Role: "user", Content: "Count to 100"})
+	conv.Add(&Message{Role: "assistant", Content: "1, 2, 3", FinishReason: params.FinishReasonStopped})
+	var buf bytes.Buffer
+	if err := WriteExport(&buf, conv); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), `"interrupted"`) {
+		t.Errorf("export without finish type interrupted: %s", buf.String())
+	}
+	convs, err := ReadExport(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	answer := convs[0].Messages[1]
+	if answer.FinishReason != params.FinishReasonStopped || !answer.Truncated {
+		t.Errorf("answer = %+v, want a truncated stopped answer", answer)
+	}
+	if _, err := ReadExport(strings.NewReader(`[]`)); err == nil {
+		t.Errorf("ReadExport of an empty export succeeded")
+	}
+}
+
+func TestJSONLRoundTrip(t *testing.T) {
+	conv := sampleConversation()
+	other := NewConversation("other")
+	other.Add(&Message{Role: "user", Content: "line one\nline two"})
+	var buf bytes.Buffer
+	if err := WriteJSONL(&buf, conv, other); err != nil {
+		t.Fatal(err)
+	}
+	convs, err := ReadJSONL(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(convs) != 2 {
+		t.Fatalf("read %d conversations, want 2", len(convs))
+	}
+	for i, want := range []*Conversation{conv, other} {
+		got := convs[i]
+		if got.ID != want.ID || got.Title != want.Title || !got.CreateTime.Equal(want.CreateTime) {
+			t.Errorf("conversation %d = %+v, want %+v", i, got, want)
+		}
+		if len(got.Messages) != len(want.Messages) {
+			t.Fatalf("conversation %d has %d messages, want %d", i, len(got.Messages), len(want.Messages))
+		}
+		for j := range want.Messages {
+			g, w := *got.Messages[j], *want.Messages[j]
+			if !g.CreateTime.Equal(w.CreateTime) {
+				t.Errorf("message %d create time = %v, want %v", j, g.CreateTime, w.CreateTime)
+			}
+			g.CreateTime, w.CreateTime = time.Time{}, time.Time{}
+			if !reflect.DeepEqual(g, w) {
+				t.Errorf("message %d = %+v, want %+v", j, g, w)
+			}
+		}
+	}
+	if _, err := ReadJSONL(strings.NewReader(`{"type":"note"}`)); err == nil {
+		t.Errorf("ReadJSONL accepted an unknown line type")
+	}
+}
+
+func TestMarkdownRoundTrip(t *testing.T) {
+	conv := sampleConversation()
+	var buf bytes.Buffer
+	if err := WriteMarkdown(&buf, conv); err != nil {
+		t.Fatal(err)
+	}
+	md := buf.String()
+	for _, want := range []string{"# Trip to Paris\n", "## Assistant (gpt-4o, truncated)\n", "![image](https://example.com/eiffel.png)"} {
+		if !strings.Contains(md, want) {
+			t.Errorf("markdown without %q:\n%s", want, md)
+		}
+	}
+	got, err := ReadMarkdown(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Title != conv.Title {
+		t.Errorf("title = %q, want %q", got.Title, conv.Title)
+	}
+	if !reflect.DeepEqual(contents(got), contents(conv)) {
+		t.Errorf("messages = %+v, want %+v", contents(got), contents(conv))
+	}
+	if !got.Messages[4].Truncated || got.Messages[2].Truncated {
+		t.Errorf("truncated flags not kept")
+	}
+	for i := 1; i < len(got.Messages); i++ {
+		if got.Messages[i].ParentID != got.Messages[i-1].ID {
+			t.Errorf("message %d is not linked to its parent", i)
+		}
+	}
+}
+
+func TestToRequest(t *testing.T) {
+	conv := sampleConversation()
+	req := conv.ToRequest()
+	if sys := req.SystemMsg(); sys == nil || sys.Request().Content != "You are a travel agent." {
+		t.Fatalf("system message = %+v", sys)
+	}
+	msgs := req.Msgs()
+	if len(msgs) != 3 {
+		t.Fatalf("request has %d messages, want 3", len(msgs))
+	}
+	first := msgs[0]
+	if first.Request().Name != "bob" || len(first.Request().MultiContent) != 2 {
+		t.Errorf("first message = %+v", first.Request())
+	}
+	if first.Answer() != "The Eiffel tower.\n\nIt is 330 m high." || first.Model() != "gpt-4o" || first.FinishReason() != "stop" || first.Truncated() {
+		t.Errorf("first answer = %q %q %q %v", first.Answer(), first.Model(), first.FinishReason(), first.Truncated())
+	}
+	if msgs[1].Answer() != "It was built" || !msgs[1].Truncated() || msgs[1].FinishReason() != "length" {
+		t.Errorf("truncated answer = %q %q %v", msgs[1].Answer(), msgs[1].FinishReason(), msgs[1].Truncated())
+	}
+	if msgs[2].Answer() != "" {
+		t.Errorf("unanswered message has answer %q", msgs[2].Answer())
+	}
+
+	// and back
+	back := FromRequest(req, conv.Title)
+	want := contents(conv)
+	if got := contents(back); !reflect.DeepEqual(got, want) {
+		t.Errorf("FromRequest(ToRequest) = %+v, want %+v", got, want)
+	}
+}
+
+func TestLoadFile(t *testing.T) {
+	dir := t.TempDir()
+	conv := sampleConversation()
+	files := map[string]func(*bytes.Buffer) error{
+		"chat.md":            func(b *bytes.Buffer) error { return WriteMarkdown(b, conv) },
+		"chat.jsonl":         func(b *bytes.Buffer) error { return WriteJSONL(b, conv) },
+		"conversations.json": func(b *bytes.Buffer) error { return WriteExport(b, conv) },
+	}
+	for name, write := range files {
+		var buf bytes.Buffer
+		if err := write(&buf); err != nil {
+			t.Fatal(err)
+		}
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, buf.Bytes(), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		convs, err := LoadFile(path)
+		if err != nil {
+			t.Errorf("LoadFile(%s): %v", name, err)
+			continue
+		}
+		if len(convs) != 1 || len(convs[0].Messages) != len(conv.Messages) {
+			t.Errorf("LoadFile(%s) = %d conversations", name, len(convs))
+		}
+	}
+	if _, err := LoadFile(filepath.Join(dir, "chat.txt")); err == nil {
+		t.Errorf("LoadFile of a missing file succeeded")
+	}
+}
@@ -0,0 +1,246 @@
+package archive
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/billikeu/go-chatgpt/chatgpt"
+	"github.com/billikeu/go-chatgpt/chatgptuno"
+	openai "github.com/sashabaranov/go-openai"
+	uuid "github.com/satori/go.uuid"
+)
+
+// a message of an archived conversation
+type Message struct {
+	ID           string    `json:"id"`
+	ParentID     string    `json:"parent_id,omitempty"`
+	Role         string    `json:"role"` // system, user or assistant
+	Name         string    `json:"name,omitempty"`
+	Content      string    `json:"content"`
+	Images       []string  `json:"images,omitempty"` // image urls of a user message
+	Model        string    `json:"model,omitempty"`
+	FinishReason string    `json:"finish_reason,omitempty"`
+	Truncated    bool      `json:"truncated,omitempty"`
+	CreateTime   time.Time `json:"create_time"` // zero: unknown
+}
+
+/*
+Conversation is a linear chat history independent of the backend. It is built from a
+chatgpt.Request or a chatgptuno.ConversationTree, written as Markdown, JSONL or the
+conversations.json of the ChatGPT data export, and read back to continue it with the API.
+
+	conv := archive.FromRequest(conversation.Request(), "support chat")
+	f, _ := os.Create("chat.md")
+	archive.WriteMarkdown(f, conv)
+
+	convs, err := archive.LoadFile("conversations.json")
+	conversation.SetRequest(convs[0].ToRequest())
+*/
+type Conversation struct {
+	ID         string     `json:"id"`
+	Title      string     `json:"title"`
+	CreateTime time.Time  `json:"create_time"`
+	UpdateTime time.Time  `json:"update_time"`
+	Messages   []*Message `json:"-"`
+}
+
+func NewConversation(title string) *Conversation {
+	now := time.Now()
+	return &Conversation{
+		ID:         uuid.NewV4().String(),
+		Title:      title,
+		CreateTime: now,
+		UpdateTime: now,
+	}
+}
+
+// append a message, its parent is the last message
+func (conv *Conversation) Add(msg *Message) {
+	if msg.ID == "" {
+		msg.ID = uuid.NewV4().String()
+	}
+	if msg.ParentID == "" && len(conv.Messages) > 0 {
+		msg.ParentID = conv.Messages[len(conv.Messages)-1].ID
+	}
+	conv.Messages = append(conv.Messages, msg)
+}
+
+// the history of a chatgpt conversation
+func FromRequest(req *chatgpt.Request, title string) *Conversation {
+	conv := NewConversation(title)
+	if sys := req.SystemMsg(); sys != nil {
+		conv.Add(requestMessage(sys))
+	}
+	for _, v := range req.Msgs() {
+		conv.Add(requestMessage(v))
+		if v.Answer() == "" {
+			continue
+		}
+		conv.Add(&Message{
+			// stable id, exporting twice gives the same ids
+			ID:           uuid.NewV5(uuid.NamespaceOID, v.Id()+"/answer").String(),
+			Role:         openai.ChatMessageRoleAssistant,
+			Content:      v.Answer(),
+			Model:        v.Model(),
+			FinishReason: v.FinishReason(),
+			Truncated:    v.Truncated(),
+		})
+	}
+	return conv
+}
+
+func requestMessage(msg *chatgpt.ChatMsg) *Message {
+	req := msg.Request()
+	m := &Message{
+		ID:      msg.Id(),
+		Role:    req.Role,
+		Name:    req.Name,
+		Content: req.Content,
+	}
+	var texts []string
+	for _, part := range req.MultiContent {
+		if part.Type == openai.ChatMessagePartTypeImageURL && part.ImageURL != nil {
+			m.Images = append(m.Images, part.ImageURL.URL)
+			continue
+		}
+		texts = append(texts, part.Text)
+	}
+	if len(texts) > 0 {
+		m.Content = strings.Join(texts, "\n")
+	}
+	return m
+}
+
+// the current branch of a chatgptuno conversation, hidden and tool messages are skipped
+func FromUnoTree(tree *chatgptuno.ConversationTree) *Conversation {
+	conv := &Conversation{
+		ID:         tree.ConversationID,
+		Title:      tree.Title,
+		CreateTime: unixTime(tree.CreateTime),
+		UpdateTime: unixTime(tree.UpdateTime),
+	}
+	for _, v := range tree.Branch("") {
+		content := strings.Join(v.Content.Parts, "")
+		switch v.Author.Role {
+		case openai.ChatMessageRoleUser, openai.ChatMessageRoleAssistant:
+		case openai.ChatMessageRoleSystem:
+			if content == "" {
+				continue
+			}
+		default:
+			continue
+		}
+		if v.Recipient != "" && v.Recipient != "all" {
+			continue
+		}
+		m := &Message{
+			ID:         v.ID,
+			Role:       v.Author.Role,
+			Content:    content,
+			CreateTime: unixTime(v.CreateTime),
+		}
+		if v.Author.Role == openai.ChatMessageRoleAssistant {
+			m.Model = v.Metadata.ModelSlug
+			m.FinishReason = v.Metadata.FinishDetails.Reason()
+			m.Truncated = v.Metadata.FinishDetails.Type == "interrupted"
+		}
+		conv.Add(m)
+	}
+	return conv
+}
+
+/*
+ToRequest rebuilds the history of a chatgpt conversation: the first system message becomes
+the system message, every user message a turn with the assistant message that follows it.
+
+	conversation.SetRequest(conv.ToRequest())
+*/
+func (conv *Conversation) ToRequest() *chatgpt.Request {
+	req := chatgpt.NewRequest()
+	messages := conv.Messages
+	if len(messages) > 0 && messages[0].Role == openai.ChatMessageRoleSystem {
+		req.PutSystemMsg(messages[0].Content, messages[0].Name)
+		messages = messages[1:]
+	}
+	for i := 0; i < len(messages); i++ {
+		v := messages[i]
+		msg := chatMsg(v)
+		turn := req.Begin(msg)
+		if v.Role != openai.ChatMessageRoleUser || i+1 >= len(messages) || messages[i+1].Role != openai.ChatMessageRoleAssistant {
+			// a message without an answer
+			req.CommitStream(turn, "", nil)
+			continue
+		}
+		i++
+		answer := messages[i]
+		if answer.Truncated {
+			req.CommitTruncated(turn, answer.Content, answer.FinishReason)
+			if answer.Model != "" {
+				// CommitTruncated has no response, keep the model
+				req.SetResStream(msg.Id(), answer.Content, &openai.ChatCompletionStreamResponse{Model: answer.Model})
+			}
+			continue
+		}
+		req.CommitStream(turn, answer.Content, &openai.ChatCompletionStreamResponse{
+			Model: answer.Model,
+			Choices: []openai.ChatCompletionStreamChoice{
+				{FinishReason: openai.FinishReason(answer.FinishReason)},
+			},
+		})
+	}
+	return req
+}
+
+func chatMsg(msg *Message) *chatgpt.ChatMsg {
+	if len(msg.Images) == 0 {
+		return chatgpt.NewChatMsg(msg.Role, msg.Content, msg.Name)
+	}
+	var parts []chatgpt.ContentPart
+	if msg.Content != "" {
+		parts = append(parts, chatgpt.TextPart(msg.Content))
+	}
+	for _, v := range msg.Images {
+		parts = append(parts, chatgpt.ImageURLPart(v, ""))
+	}
+	return chatgpt.NewChatMsgParts(msg.Role, parts, msg.Name)
+}
+
+// load conversations from a .md, .jsonl or .json (ChatGPT data export) file
+func LoadFile(path string) ([]*Conversation, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".md", ".markdown":
+		conv, err := ReadMarkdown(f)
+		if err != nil {
+			return nil, err
+		}
+		return []*Conversation{conv}, nil
+	case ".jsonl":
+		return ReadJSONL(f)
+	case ".json":
+		return ReadExport(f)
+	}
+	return nil, fmt.Errorf("unsupported archive type: %s", path)
+}
+
+func unixTime(sec float64) time.Time {
+	if sec <= 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, int64(sec*float64(time.Second)))
+}
+
+func unixSeconds(t time.Time) float64 {
+	if t.IsZero() {
+		return 0
+	}
+	return float64(t.UnixNano()) / float64(time.Second)
+}
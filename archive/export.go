@@ -0,0 +1,242 @@
+package archive
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"strings"
+
+	"github.com/billikeu/go-chatgpt/params"
+	openai "github.com/sashabaranov/go-openai"
+	uuid "github.com/satori/go.uuid"
+)
+
+// conversations.json of the ChatGPT data export begin ++++++++++++++++++++++++++++
+
+type exportConversation struct {
+	ID             string                 `json:"id"`
+	ConversationID string                 `json:"conversation_id"`
+	Title          string                 `json:"title"`
+	CreateTime     float64                `json:"create_time"`
+	UpdateTime     float64                `json:"update_time"`
+	Mapping        map[string]*exportNode `json:"mapping"`
+	CurrentNode    string                 `json:"current_node"`
+}
+
+type exportNode struct {
+	ID       string         `json:"id"`
+	Message  *exportMessage `json:"message"`
+	Parent   *string        `json:"parent"`
+	Children []string       `json:"children"`
+}
+
+type exportMessage struct {
+	ID         string         `json:"id"`
+	Author     exportAuthor   `json:"author"`
+	CreateTime *float64       `json:"create_time"`
+	Content    exportContent  `json:"content"`
+	Status     string         `json:"status,omitempty"`
+	EndTurn    *bool          `json:"end_turn"`
+	Weight     float64        `json:"weight"`
+	Metadata   exportMetadata `json:"metadata"`
+	Recipient  string         `json:"recipient"`
+}
+
+type exportAuthor struct {
+	Role string  `json:"role"`
+	Name *string `json:"name"`
+}
+
+type exportContent struct {
+	ContentType string        `json:"content_type"`
+	Parts       []interface{} `json:"parts,omitempty"` // strings, or objects for images
+}
+
+type exportMetadata struct {
+	ModelSlug     string        `json:"model_slug,omitempty"`
+	FinishDetails *exportFinish `json:"finish_details,omitempty"`
+	Hidden        bool          `json:"is_visually_hidden_from_conversation,omitempty"`
+	Truncated     bool          `json:"truncated,omitempty"`
+}
+
+type exportFinish struct {
+	Type string `json:"type"`
+}
+
+type exportImage struct {
+	ContentType  string `json:"content_type"`
+	AssetPointer string `json:"asset_pointer"`
+}
+
+// finish reasons of the api and finish_details types of the export
+var exportFinishTypes = map[string]string{
+	"stop":                     "stop",
+	"length":                   "max_tokens",
+	params.FinishReasonStopped: "interrupted",
+}
+
+/*
+write conversations in the format of conversations.json of the ChatGPT data export,
+every conversation is a single branch.
+*/
+func WriteExport(w io.Writer, convs ...*Conversation) error {
+	items := make([]*exportConversation, 0, len(convs))
+	for _, conv := range convs {
+		items = append(items, toExport(conv))
+	}
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	return enc.Encode(items)
+}
+
+func toExport(conv *Conversation) *exportConversation {
+	root := uuid.NewV5(uuid.NamespaceOID, conv.ID+"/root").String()
+	item := &exportConversation{
+		ID:             conv.ID,
+		ConversationID: conv.ID,
+		Title:          conv.Title,
+		CreateTime:     unixSeconds(conv.CreateTime),
+		UpdateTime:     unixSeconds(conv.UpdateTime),
+		Mapping: map[string]*exportNode{
+			root: {ID: root, Children: []string{}},
+		},
+		CurrentNode: root,
+	}
+	parent := root
+	for _, v := range conv.Messages {
+		msg := &exportMessage{
+			ID:        v.ID,
+			Author:    exportAuthor{Role: v.Role},
+			Content:   exportContent{ContentType: "text", Parts: []interface{}{v.Content}},
+			Status:    "finished_successfully",
+			Weight:    1,
+			Recipient: "all",
+		}
+		if v.Name != "" {
+			name := v.Name
+			msg.Author.Name = &name
+		}
+		if !v.CreateTime.IsZero() {
+			t := unixSeconds(v.CreateTime)
+			msg.CreateTime = &t
+		}
+		for _, url := range v.Images {
+			msg.Content.ContentType = "multimodal_text"
+			msg.Content.Parts = append(msg.Content.Parts, exportImage{ContentType: "image_asset_pointer", AssetPointer: url})
+		}
+		if v.Role == openai.ChatMessageRoleAssistant {
+			endTurn := true
+			msg.EndTurn = &endTurn
+			msg.Metadata.ModelSlug = v.Model
+			msg.Metadata.Truncated = v.Truncated
+			if v.FinishReason != "" {
+				finishType, ok := exportFinishTypes[v.FinishReason]
+				if !ok {
+					finishType = v.FinishReason
+				}
+				msg.Metadata.FinishDetails = &exportFinish{Type: finishType}
+			}
+		}
+		p := parent
+		item.Mapping[v.ID] = &exportNode{ID: v.ID, Message: msg, Parent: &p, Children: []string{}}
+		item.Mapping[parent].Children = append(item.Mapping[parent].Children, v.ID)
+		parent = v.ID
+	}
+	item.CurrentNode = parent
+	return item
+}
+
+// read conversations.json of the ChatGPT data export, the current branch of every conversation is kept
+func ReadExport(r io.Reader) ([]*Conversation, error) {
+	var items []*exportConversation
+	if err := json.NewDecoder(r).Decode(&items); err != nil {
+		return nil, err
+	}
+	if len(items) == 0 {
+		return nil, errors.New("no conversations in export")
+	}
+	convs := make([]*Conversation, 0, len(items))
+	for _, v := range items {
+		convs = append(convs, fromExport(v))
+	}
+	return convs, nil
+}
+
+func fromExport(item *exportConversation) *Conversation {
+	conv := &Conversation{
+		ID:         item.ConversationID,
+		Title:      item.Title,
+		CreateTime: unixTime(item.CreateTime),
+		UpdateTime: unixTime(item.UpdateTime),
+	}
+	if conv.ID == "" {
+		conv.ID = item.ID
+	}
+	// walk from the current node to the root
+	var branch []*exportMessage
+	seen := map[string]bool{}
+	for node := item.Mapping[item.CurrentNode]; node != nil && !seen[node.ID]; {
+		seen[node.ID] = true
+		if node.Message != nil {
+			branch = append(branch, node.Message)
+		}
+		if node.Parent == nil {
+			break
+		}
+		node = item.Mapping[*node.Parent]
+	}
+	for i := len(branch) - 1; i >= 0; i-- {
+		v := branch[i]
+		if v.Metadata.Hidden || (v.Recipient != "" && v.Recipient != "all") {
+			continue
+		}
+		msg := &Message{ID: v.ID, Role: v.Author.Role}
+		switch v.Author.Role {
+		case openai.ChatMessageRoleSystem, openai.ChatMessageRoleUser, openai.ChatMessageRoleAssistant:
+		default:
+			continue
+		}
+		if v.Author.Name != nil {
+			msg.Name = *v.Author.Name
+		}
+		if v.CreateTime != nil {
+			msg.CreateTime = unixTime(*v.CreateTime)
+		}
+		var texts []string
+		for _, part := range v.Content.Parts {
+			switch p := part.(type) {
+			case string:
+				texts = append(texts, p)
+			case map[string]interface{}:
+				// images uploaded to ChatGPT point to its file service and are not kept
+				url, _ := p["asset_pointer"].(string)
+				if strings.HasPrefix(url, "http://") || strings.HasPrefix(url, "https://") || strings.HasPrefix(url, "data:") {
+					msg.Images = append(msg.Images, url)
+				}
+			}
+		}
+		msg.Content = strings.Join(texts, "")
+		if msg.Content == "" && len(msg.Images) == 0 {
+			continue
+		}
+		if v.Author.Role == openai.ChatMessageRoleAssistant {
+			msg.Model = v.Metadata.ModelSlug
+			msg.Truncated = v.Metadata.Truncated
+			if v.Metadata.FinishDetails != nil {
+				msg.FinishReason = v.Metadata.FinishDetails.Type
+				for reason, finishType := range exportFinishTypes {
+					if finishType == v.Metadata.FinishDetails.Type {
+						msg.FinishReason = reason
+					}
+				}
+				if msg.FinishReason == params.FinishReasonStopped {
+					msg.Truncated = true
+				}
+			}
+		}
+		conv.Add(msg)
+	}
+	return conv
+}
+
+// conversations.json of the ChatGPT data export end ------------------------------
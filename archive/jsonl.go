@@ -0,0 +1,93 @@
+package archive
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// line types of the jsonl format
+const (
+	lineConversation = "conversation"
+	lineMessage      = "message"
+)
+
+type conversationLine struct {
+	Type string `json:"type"`
+	*Conversation
+}
+
+type messageLine struct {
+	Type string `json:"type"`
+	*Message
+}
+
+/*
+write conversations as JSON lines, a conversation line followed by its message lines:
+
+	{"type":"conversation","id":"...","title":"...","create_time":"...","update_time":"..."}
+	{"type":"message","id":"...","role":"user","content":"Hello",...}
+*/
+func WriteJSONL(w io.Writer, convs ...*Conversation) error {
+	bw := bufio.NewWriter(w)
+	enc := json.NewEncoder(bw)
+	enc.SetEscapeHTML(false)
+	for _, conv := range convs {
+		if err := enc.Encode(conversationLine{Type: lineConversation, Conversation: conv}); err != nil {
+			return err
+		}
+		for _, v := range conv.Messages {
+			if err := enc.Encode(messageLine{Type: lineMessage, Message: v}); err != nil {
+				return err
+			}
+		}
+	}
+	return bw.Flush()
+}
+
+// read conversations written by WriteJSONL, message lines before a conversation line start a new conversation
+func ReadJSONL(r io.Reader) ([]*Conversation, error) {
+	var convs []*Conversation
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 64<<20)
+	for n := 1; scanner.Scan(); n++ {
+		b := scanner.Bytes()
+		if len(b) == 0 {
+			continue
+		}
+		var line struct {
+			Type string `json:"type"`
+		}
+		if err := json.Unmarshal(b, &line); err != nil {
+			return nil, fmt.Errorf("jsonl line %d err:%s", n, err.Error())
+		}
+		switch line.Type {
+		case lineConversation:
+			conv := &Conversation{}
+			if err := json.Unmarshal(b, conv); err != nil {
+				return nil, fmt.Errorf("jsonl line %d err:%s", n, err.Error())
+			}
+			convs = append(convs, conv)
+		case lineMessage:
+			msg := &Message{}
+			if err := json.Unmarshal(b, msg); err != nil {
+				return nil, fmt.Errorf("jsonl line %d err:%s", n, err.Error())
+			}
+			if len(convs) == 0 {
+				convs = append(convs, NewConversation(""))
+			}
+			convs[len(convs)-1].Add(msg)
+		default:
+			return nil, fmt.Errorf("jsonl line %d has unknown type %q", n, line.Type)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(convs) == 0 {
+		return nil, errors.New("no conversations in jsonl")
+	}
+	return convs, nil
+}
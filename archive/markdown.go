@@ -0,0 +1,137 @@
+package archive
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+var roleTitles = map[string]string{
+	openai.ChatMessageRoleSystem:    "System",
+	openai.ChatMessageRoleUser:      "User",
+	openai.ChatMessageRoleAssistant: "Assistant",
+}
+
+// ## Assistant (gpt-4o, truncated)
+var headingRe = regexp.MustCompile(`^## (System|User|Assistant)(?: \((.*)\))?$`)
+
+// ![image](url)
+var imageRe = regexp.MustCompile(`^!\[image\]\((.+)\)$`)
+
+/*
+write a conversation as Markdown, one "## Role" section per message:
+
+	# Title
+
+	## User
+
+	Hello
+
+	## Assistant (gpt-4o)
+
+	Hi, how can I help?
+
+Images are written as ![image](url) lines. A message line that looks like a role heading
+can not be read back by ReadMarkdown.
+*/
+func WriteMarkdown(w io.Writer, conv *Conversation) error {
+	bw := bufio.NewWriter(w)
+	title := conv.Title
+	if title == "" {
+		title = "Conversation"
+	}
+	fmt.Fprintf(bw, "# %s\n", title)
+	for _, v := range conv.Messages {
+		role, ok := roleTitles[v.Role]
+		if !ok {
+			continue
+		}
+		var notes []string
+		if v.Model != "" {
+			notes = append(notes, v.Model)
+		}
+		if v.Truncated {
+			notes = append(notes, "truncated")
+		}
+		if len(notes) > 0 {
+			role += " (" + strings.Join(notes, ", ") + ")"
+		}
+		fmt.Fprintf(bw, "\n## %s\n\n", role)
+		if v.Content != "" {
+			fmt.Fprintf(bw, "%s\n", strings.TrimRight(v.Content, "\n"))
+		}
+		for _, url := range v.Images {
+			fmt.Fprintf(bw, "\n![image](%s)\n", url)
+		}
+	}
+	return bw.Flush()
+}
+
+// read a conversation written by WriteMarkdown
+func ReadMarkdown(r io.Reader) (*Conversation, error) {
+	conv := NewConversation("")
+	var msg *Message
+	var lines []string
+	flush := func() {
+		if msg == nil {
+			return
+		}
+		// trailing image lines are the images of the message
+		for len(lines) > 0 {
+			last := strings.TrimSpace(lines[len(lines)-1])
+			if last == "" {
+				lines = lines[:len(lines)-1]
+				continue
+			}
+			m := imageRe.FindStringSubmatch(last)
+			if m == nil {
+				break
+			}
+			msg.Images = append([]string{m[1]}, msg.Images...)
+			lines = lines[:len(lines)-1]
+		}
+		msg.Content = strings.Trim(strings.Join(lines, "\n"), "\n")
+		conv.Add(msg)
+	}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 64<<20)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if msg == nil && conv.Title == "" && strings.HasPrefix(line, "# ") {
+			conv.Title = strings.TrimSpace(line[2:])
+			continue
+		}
+		m := headingRe.FindStringSubmatch(line)
+		if m == nil {
+			if msg != nil {
+				lines = append(lines, line)
+			}
+			continue
+		}
+		flush()
+		msg = &Message{Role: strings.ToLower(m[1])}
+		lines = nil
+		for _, note := range strings.Split(m[2], ", ") {
+			switch note {
+			case "":
+			case "truncated":
+				msg.Truncated = true
+			default:
+				msg.Model = note
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	flush()
+	if len(conv.Messages) == 0 {
+		return nil, errors.New("no messages in markdown")
+	}
+	return conv, nil
+}
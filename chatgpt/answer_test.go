@@ -0,0 +1,96 @@
+package chatgpt
+
+import (
+	"context"
+	"regexp"
+	"testing"
+
+	"github.com/billikeu/go-chatgpt/moderation"
+	"github.com/billikeu/go-chatgpt/params"
+	openai "github.com/sashabaranov/go-openai"
+)
+
+func askAll(t *testing.T, chat *ChatGPTConversion, prompt string) []*params.Answer {
+	var answers []*params.Answer
+	if err := chat.Ask(context.Background(), prompt, func(answer *params.Answer, err error) {
+		if err != nil {
+			t.Errorf("callback err = %v", err)
+			return
+		}
+		answers = append(answers, answer)
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if len(answers) == 0 || !answers[len(answers)-1].Done {
+		t.Fatalf("%d answers without a done one", len(answers))
+	}
+	return answers
+}
+
+func TestAnswerMetadata(t *testing.T) {
+	tests := []struct {
+		name        string
+		stream      bool
+		streamUsage bool
+		estimated   bool
+	}{
+		{"streamed", true, false, true},
+		{"streamed with usage", true, true, false},
+		{"not streamed", false, false, false},
+	}
+	for _, tt := range tests {
+		s := newStubServer(t, func(req *openai.ChatCompletionRequest) string { return "hello there friend" })
+		chat := s.conversation()
+		chat.SetStream(tt.stream)
+		chat.SetStreamUsage(tt.streamUsage)
+		answers := askAll(t, chat, "hi")
+
+		if req := s.chatRequests()[0]; req.Stream != tt.stream || (req.StreamOptions != nil && req.StreamOptions.IncludeUsage) != tt.streamUsage {
+			t.Errorf("%s: request stream %v, options %+v", tt.name, req.Stream, req.StreamOptions)
+		}
+		if !tt.stream && len(answers) != 1 {
+			t.Errorf("%s: %d answers without streaming", tt.name, len(answers))
+		}
+		for i, v := range answers {
+			if v.Reset || v.Model != "gpt-3.5-turbo-0613" || v.ChunkIndex != i+1 {
+				t.Errorf("%s: answer %d = %+v", tt.name, i, v)
+			}
+			if !v.Done && (v.FinishReason != "" || v.Usage != nil) {
+				t.Errorf("%s: chunk %d has finish reason %q, usage %+v", tt.name, i, v.FinishReason, v.Usage)
+			}
+		}
+		last := answers[len(answers)-1]
+		if last.FinishReason != "stop" || last.Text != "hello there friend" || last.Usage == nil || last.Usage.Estimated != tt.estimated {
+			t.Fatalf("%s: last answer = %+v, usage %+v", tt.name, last, last.Usage)
+		}
+		if !tt.estimated && (last.Usage.PromptTokens != 10 || last.Usage.CompletionTokens != 5 || last.Usage.TotalTokens != 15) {
+			t.Errorf("%s: usage = %+v", tt.name, last.Usage)
+		}
+		if msg := chat.Request().Msgs()[0]; msg.FinishReason() != "stop" || msg.Model() != "gpt-3.5-turbo-0613" {
+			t.Errorf("%s: history keeps finish reason %q, model %q", tt.name, msg.FinishReason(), msg.Model())
+		}
+	}
+}
+
+func TestAnswerReset(t *testing.T) {
+	s := newStubServer(t, func(req *openai.ChatCompletionRequest) string { return "code 1234 5678 done" })
+	chat := s.conversation()
+	// the code is redacted once its second half arrives, after the first half was shown
+	chat.SetModeration(nil, moderation.NewRuleEngine(moderation.Rule{Name: "code", Pattern: regexp.MustCompile(`\d{4} \d{4}`), Action: moderation.ActionRedact}))
+	answers := askAll(t, chat, "hi")
+
+	var shown string
+	resets := 0
+	for _, v := range answers {
+		if v.Reset {
+			resets++
+			shown = v.Chunk
+		} else {
+			shown += v.Chunk
+		}
+	}
+	last := answers[len(answers)-1]
+	if resets != 1 || shown != last.Text || last.Text != "code [redacted] done" {
+		t.Errorf("%d resets, shown %q, answer %q", resets, shown, last.Text)
+	}
+}
@@ -0,0 +1,321 @@
+package chatgpt
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// a cached answer, replayed chunk by chunk
+type CacheEntry struct {
+	Text         string    `json:"text"`
+	Chunks       []string  `json:"chunks"`
+	FinishReason string    `json:"finish_reason"`
+	Model        string    `json:"model"`
+	CreatedAt    time.Time `json:"created_at"`
+	ExpiresAt    time.Time `json:"expires_at"` // zero: never expires
+}
+
+func (entry *CacheEntry) expired(now time.Time) bool {
+	return !entry.ExpiresAt.IsZero() && now.After(entry.ExpiresAt)
+}
+
+// the stream response kept in history for a replayed answer
+func (entry *CacheEntry) streamResponse() *openai.ChatCompletionStreamResponse {
+	return &openai.ChatCompletionStreamResponse{
+		Model: entry.Model,
+		Choices: []openai.ChatCompletionStreamChoice{
+			{FinishReason: openai.FinishReason(entry.FinishReason)},
+		},
+	}
+}
+
+// answer cache of Ask, see NewLRUCache and NewDiskCache
+type Cache interface {
+	Get(key string) (*CacheEntry, bool)
+	// ttl <= 0: never expires
+	Set(key string, entry *CacheEntry, ttl time.Duration)
+}
+
+type cacheKeyMessage struct {
+	Role    string   `json:"role"`
+	Name    string   `json:"name,omitempty"`
+	Content string   `json:"content"`
+	Parts   []string `json:"parts,omitempty"` // text or image digest
+}
+
+type cacheKeyRequest struct {
+	Model            string            `json:"model"`
+	MaxTokens        int               `json:"max_tokens"`
+	Temperature      float32           `json:"temperature"`
+	TopP             float32           `json:"top_p"`
+	N                int               `json:"n"`
+	Stop             []string          `json:"stop"`
+	PresencePenalty  float32           `json:"presence_penalty"`
+	FrequencyPenalty float32           `json:"frequency_penalty"`
+	LogitBias        map[string]int    `json:"logit_bias"`
+	ResponseFormat   string            `json:"response_format,omitempty"`
+	Messages         []cacheKeyMessage `json:"messages"`
+}
+
+// collapse whitespace, the cache ignores formatting differences of prompts
+func normalizePrompt(content string) string {
+	return strings.Join(strings.Fields(content), " ")
+}
+
+// cache key of a request: model, parameters and the normalized message list
+func CacheKey(req openai.ChatCompletionRequest) string {
+	key := cacheKeyRequest{
+		Model:            req.Model,
+		MaxTokens:        req.MaxTokens,
+		Temperature:      req.Temperature,
+		TopP:             req.TopP,
+		N:                req.N,
+		Stop:             req.Stop,
+		PresencePenalty:  req.PresencePenalty,
+		FrequencyPenalty: req.FrequencyPenalty,
+		LogitBias:        req.LogitBias,
+		Messages:         make([]cacheKeyMessage, 0, len(req.Messages)),
+	}
+	if req.ResponseFormat != nil {
+		key.ResponseFormat = string(req.ResponseFormat.Type)
+	}
+	for _, v := range req.Messages {
+		msg := cacheKeyMessage{
+			Role:    v.Role,
+			Name:    v.Name,
+			Content: normalizePrompt(v.Content),
+		}
+		for _, part := range v.MultiContent {
+			if part.Type == openai.ChatMessagePartTypeImageURL {
+				msg.Parts = append(msg.Parts, "image:"+imageDigest(part.ImageURL.URL)+":"+string(part.ImageURL.Detail))
+				continue
+			}
+			msg.Parts = append(msg.Parts, "text:"+normalizePrompt(part.Text))
+		}
+		key.Messages = append(key.Messages, msg)
+	}
+	b, _ := json.Marshal(key)
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+/*
+set answer cache, nil: disable.
+Answers of identical requests are replayed from the cache as a synthetic stream.
+
+	chat.SetCache(chatgpt.NewLRUCache(1000), time.Hour)
+*/
+func (chat *ChatGPTConversion) SetCache(cache Cache, ttl time.Duration) {
+	chat.cache = cache
+	chat.cacheTTL = ttl
+}
+
+func (chat *ChatGPTConversion) cacheGet(key string) (*CacheEntry, bool) {
+	if chat.cache == nil {
+		return nil, false
+	}
+	return chat.cache.Get(key)
+}
+
+// store a new answer in the exact and the semantic cache
+func (chat *ChatGPTConversion) storeCache(key string, semKey *semanticKey, entry *CacheEntry) {
+	entry.CreatedAt = time.Now()
+	chat.semanticSet(semKey, entry)
+	if chat.cache == nil {
+		return
+	}
+	chat.cache.Set(key, entry, chat.cacheTTL)
+}
+
+// replay a cached answer as a stream, emit is called per chunk and once with done.
+// Without streaming emit is only called with done.
+func (chat *ChatGPTConversion) replayCache(ctx context.Context, state *answerState, entry *CacheEntry, emit func(chunk string, done bool)) error {
+	var text string
+	for _, v := range entry.Chunks {
+		text += v
+		if chat.nonStreaming() {
+			continue
+		}
+		chunk, err := chat.updateOutput(ctx, state, text, false)
+		if err != nil {
+			return err
+		}
+		emit(chunk, false)
+	}
+	chunk, err := chat.updateOutput(ctx, state, text, true)
+	if err != nil {
+		return err
+	}
+	emit(chunk, true)
+	return nil
+}
+
+// lru cache begin ++++++++++++++++++++++++++++++++++++++++++++++++++++++++
+
+type lruItem struct {
+	key   string
+	entry *CacheEntry
+}
+
+// in-memory cache, the least recently used entry is evicted when it is full
+type LRUCache struct {
+	size  int
+	items map[string]*list.Element
+	order *list.List
+	sync.Mutex
+}
+
+// size <= 0: 1000
+func NewLRUCache(size int) *LRUCache {
+	if size <= 0 {
+		size = 1000
+	}
+	return &LRUCache{
+		size:  size,
+		items: make(map[string]*list.Element),
+		order: list.New(),
+	}
+}
+
+func (c *LRUCache) Get(key string) (*CacheEntry, bool) {
+	c.Lock()
+	defer c.Unlock()
+
+	elem, ok := c.items[key]
+	if !ok {
+		return nil, false
+	}
+	item := elem.Value.(*lruItem)
+	if item.entry.expired(time.Now()) {
+		c.order.Remove(elem)
+		delete(c.items, key)
+		return nil, false
+	}
+	c.order.MoveToFront(elem)
+	return item.entry, true
+}
+
+func (c *LRUCache) Set(key string, entry *CacheEntry, ttl time.Duration) {
+	c.Lock()
+	defer c.Unlock()
+
+	if ttl > 0 {
+		entry.ExpiresAt = time.Now().Add(ttl)
+	}
+	if elem, ok := c.items[key]; ok {
+		elem.Value.(*lruItem).entry = entry
+		c.order.MoveToFront(elem)
+		return
+	}
+	c.items[key] = c.order.PushFront(&lruItem{key: key, entry: entry})
+	for c.order.Len() > c.size {
+		elem := c.order.Back()
+		c.order.Remove(elem)
+		delete(c.items, elem.Value.(*lruItem).key)
+	}
+}
+
+func (c *LRUCache) Len() int {
+	c.Lock()
+	defer c.Unlock()
+
+	return c.order.Len()
+}
+
+// lru cache end ----------------------------------------------------------
+
+// disk cache begin +++++++++++++++++++++++++++++++++++++++++++++++++++++++
+
+// one json file per entry in dir, it survives restarts
+type DiskCache struct {
+	dir string
+	sync.Mutex
+}
+
+func NewDiskCache(dir string) (*DiskCache, error) {
+	if dir == "" {
+		return nil, errors.New("disk cache dir is empty")
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	return &DiskCache{dir: dir}, nil
+}
+
+func (c *DiskCache) path(key string) string {
+	return filepath.Join(c.dir, key+".json")
+}
+
+func (c *DiskCache) Get(key string) (*CacheEntry, bool) {
+	c.Lock()
+	defer c.Unlock()
+
+	b, err := os.ReadFile(c.path(key))
+	if err != nil {
+		return nil, false
+	}
+	entry := &CacheEntry{}
+	if err := json.Unmarshal(b, entry); err != nil {
+		os.Remove(c.path(key))
+		return nil, false
+	}
+	if entry.expired(time.Now()) {
+		os.Remove(c.path(key))
+		return nil, false
+	}
+	return entry, true
+}
+
+func (c *DiskCache) Set(key string, entry *CacheEntry, ttl time.Duration) {
+	c.Lock()
+	defer c.Unlock()
+
+	if ttl > 0 {
+		entry.ExpiresAt = time.Now().Add(ttl)
+	}
+	b, err := json.Marshal(entry)
+	if err != nil {
+		return
+	}
+	tmp := c.path(key) + ".tmp"
+	if err := os.WriteFile(tmp, b, 0o600); err != nil {
+		return
+	}
+	os.Rename(tmp, c.path(key))
+}
+
+// remove expired entries
+func (c *DiskCache) Prune() error {
+	c.Lock()
+	defer c.Unlock()
+
+	files, err := filepath.Glob(filepath.Join(c.dir, "*.json"))
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	for _, file := range files {
+		b, err := os.ReadFile(file)
+		if err != nil {
+			continue
+		}
+		entry := &CacheEntry{}
+		if json.Unmarshal(b, entry) != nil || entry.expired(now) {
+			os.Remove(file)
+		}
+	}
+	return nil
+}
+
+// disk cache end ---------------------------------------------------------
@@ -0,0 +1,152 @@
+package chatgpt
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/billikeu/go-chatgpt/params"
+	openai "github.com/sashabaranov/go-openai"
+)
+
+func TestLRUCacheEviction(t *testing.T) {
+	c := NewLRUCache(2)
+	c.Set("a", &CacheEntry{Text: "a"}, 0)
+	c.Set("b", &CacheEntry{Text: "b"}, 0)
+	// a is used more recently than b
+	if _, ok := c.Get("a"); !ok {
+		t.Fatal("a not cached")
+	}
+	c.Set("c", &CacheEntry{Text: "c"}, 0)
+	if _, ok := c.Get("b"); ok {
+		t.Errorf("least recently used b not evicted")
+	}
+	for _, key := range []string{"a", "c"} {
+		if entry, ok := c.Get(key); !ok || entry.Text != key {
+			t.Errorf("Get(%s) = %+v, %v", key, entry, ok)
+		}
+	}
+	if c.Len() != 2 {
+		t.Errorf("Len = %d", c.Len())
+	}
+
+	c.Set("d", &CacheEntry{Text: "d"}, time.Nanosecond)
+	time.Sleep(time.Millisecond)
+	if _, ok := c.Get("d"); ok || c.Len() != 1 {
+		t.Errorf("expired entry returned, %d entries", c.Len())
+	}
+}
+
+func TestDiskCache(t *testing.T) {
+	dir := t.TempDir()
+	c, err := NewDiskCache(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entry := &CacheEntry{Text: "hello there", Chunks: []string{"hello ", "there"}, FinishReason: "stop", Model: "gpt-3.5-turbo-0613", CreatedAt: time.Now().UTC().Truncate(time.Second)}
+	c.Set("key", entry, time.Hour)
+
+	// a new cache on the same dir, like after a restart
+	c, _ = NewDiskCache(dir)
+	got, ok := c.Get("key")
+	if !ok || !reflect.DeepEqual(got.Chunks, entry.Chunks) || got.Text != entry.Text || got.Model != entry.Model || !got.CreatedAt.Equal(entry.CreatedAt) || got.ExpiresAt.IsZero() {
+		t.Errorf("Get = %+v, %v", got, ok)
+	}
+	if _, ok := c.Get("other"); ok {
+		t.Errorf("Get of a missing key succeeded")
+	}
+
+	c.Set("old", &CacheEntry{Text: "old", ExpiresAt: time.Now().Add(-time.Minute)}, 0)
+	if err := c.Prune(); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := c.Get("old"); ok {
+		t.Errorf("expired entry returned")
+	}
+	if _, ok := c.Get("key"); !ok {
+		t.Errorf("Prune removed a valid entry")
+	}
+}
+
+func TestCacheKey(t *testing.T) {
+	request := func(change func(req *openai.ChatCompletionRequest)) openai.ChatCompletionRequest {
+		req := openai.ChatCompletionRequest{
+			Model:       openai.GPT3Dot5Turbo,
+			Temperature: 0.5,
+			Messages: []openai.ChatCompletionMessage{
+				{Role: openai.ChatMessageRoleSystem, Content: "be brief"},
+				{Role: openai.ChatMessageRoleUser, Content: "hello there"},
+			},
+		}
+		if change != nil {
+			change(&req)
+		}
+		return req
+	}
+	key := CacheKey(request(nil))
+	if got := CacheKey(request(func(req *openai.ChatCompletionRequest) { req.Messages[1].Content = "  hello\n there " })); got != key {
+		t.Errorf("whitespace of the prompt changed the key")
+	}
+	changes := map[string]func(req *openai.ChatCompletionRequest){
+		"model":          func(req *openai.ChatCompletionRequest) { req.Model = openai.GPT4 },
+		"temperature":    func(req *openai.ChatCompletionRequest) { req.Temperature = 1 },
+		"max tokens":     func(req *openai.ChatCompletionRequest) { req.MaxTokens = 100 },
+		"n":              func(req *openai.ChatCompletionRequest) { req.N = 2 },
+		"system message": func(req *openai.ChatCompletionRequest) { req.Messages[0].Content = "be verbose" },
+		"prompt":         func(req *openai.ChatCompletionRequest) { req.Messages[1].Content = "hello" },
+		"json mode": func(req *openai.ChatCompletionRequest) {
+			req.ResponseFormat = &openai.ChatCompletionResponseFormat{Type: openai.ChatCompletionResponseFormatTypeJSONObject}
+		},
+	}
+	for name, change := range changes {
+		if CacheKey(request(change)) == key {
+			t.Errorf("%s does not change the key", name)
+		}
+	}
+}
+
+func TestCacheReplay(t *testing.T) {
+	for _, stream := range []bool{true, false} {
+		s := newStubServer(t, func(req *openai.ChatCompletionRequest) string { return "hello there friend" })
+		chat := s.conversation()
+		chat.SetStream(stream)
+		chat.SetCache(NewLRUCache(10), time.Hour)
+
+		var answers [2][]*params.Answer
+		for i := range answers {
+			chat.SetRequest(NewRequest())
+			if err := chat.Ask(context.Background(), "hi", func(answer *params.Answer, err error) {
+				if err == nil {
+					answers[i] = append(answers[i], answer)
+				}
+			}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if n := len(s.chatRequests()); n != 1 {
+			t.Errorf("stream %v: %d requests, the second Ask is not cached", stream, n)
+		}
+		replayed := answers[1]
+		last := replayed[len(replayed)-1]
+		if !last.Done || last.Text != "hello there friend" || last.FinishReason != "stop" || last.Model != "gpt-3.5-turbo-0613" {
+			t.Errorf("stream %v: replayed answer = %+v", stream, last)
+		}
+		if stream {
+			var chunks []string
+			for _, v := range replayed {
+				chunks = append(chunks, v.Chunk)
+			}
+			if len(replayed) != len(answers[0]) || strings.Join(chunks, "") != last.Text {
+				t.Errorf("replayed chunks %q", chunks)
+			}
+		} else if len(replayed) != 1 || last.Chunk != last.Text {
+			// the whole answer in one callback, like without the cache
+			t.Errorf("replay without streaming sent %d answers", len(replayed))
+		}
+		if msgs := chat.Request().Msgs(); len(msgs) != 1 || msgs[0].Answer() != "hello there friend" {
+			t.Errorf("stream %v: replayed answer not in the history", stream)
+		}
+	}
+}
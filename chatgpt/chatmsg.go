@@ -11,6 +11,9 @@ type ChatMsg struct {
 	response       *openai.ChatCompletionResponse
 	responseStream *openai.ChatCompletionStreamResponse
 	resText        string
+	finishReason   string
+	truncated      bool     // the answer was stopped before it finished
+	candidates     []string // answers of all choices after output moderation, n > 1
 }
 
 func NewChatMsg(role, content, name string) *ChatMsg {
@@ -26,3 +29,44 @@ func NewChatMsg(role, content, name string) *ChatMsg {
 	}
 	return req
 }
+
+// a user or system message with text and image parts
+func NewChatMsgParts(role string, parts []ContentPart, name string) *ChatMsg {
+	msg := NewChatMsg(role, "", name)
+	msg.request.MultiContent = toMessageParts(parts)
+	return msg
+}
+
+func (msg *ChatMsg) Id() string {
+	return msg.id
+}
+
+// the request message
+func (msg *ChatMsg) Request() openai.ChatCompletionMessage {
+	return *msg.request
+}
+
+// the answer text kept in the history
+func (msg *ChatMsg) Answer() string {
+	return msg.resText
+}
+
+func (msg *ChatMsg) FinishReason() string {
+	return msg.finishReason
+}
+
+// the answer was stopped before it finished
+func (msg *ChatMsg) Truncated() bool {
+	return msg.truncated
+}
+
+// model that answered, empty when unknown
+func (msg *ChatMsg) Model() string {
+	if msg.response != nil && msg.response.Model != "" {
+		return msg.response.Model
+	}
+	if msg.responseStream != nil {
+		return msg.responseStream.Model
+	}
+	return ""
+}
@@ -0,0 +1,85 @@
+package chatgpt
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/billikeu/go-chatgpt/params"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// picks the candidate kept in the history, candidates are the answers shown to the caller
+type ChoiceSelector func(candidates []string) int
+
+// set streaming, default true. Without streaming the whole answer is returned by one callback
+func (chat *ChatGPTConversion) SetStream(stream bool) {
+	chat.noStream = !stream
+}
+
+/*
+set the number of candidates per Ask, default 1.
+n > 1 always uses the non-streaming API, selector picks the candidate kept in the history,
+nil: the first one. All candidates are returned in Answer.Candidates.
+
+	chat.SetN(3, func(candidates []string) int { return longest(candidates) })
+*/
+func (chat *ChatGPTConversion) SetN(n int, selector ChoiceSelector) {
+	if n < 1 {
+		n = 1
+	}
+	chat.n = n
+	chat.choiceSelector = selector
+}
+
+// the non-streaming API is used
+func (chat *ChatGPTConversion) nonStreaming() bool {
+	return chat.noStream || chat.n > 1
+}
+
+// answer states of all choices, each one starts from the prompt moderation results of state
+func (chat *ChatGPTConversion) candidates(ctx context.Context, state *answerState, resp *openai.ChatCompletionResponse) ([]*answerState, error) {
+	if len(resp.Choices) == 0 {
+		return nil, errors.New("no choices in response")
+	}
+	states := make([]*answerState, len(resp.Choices))
+	for _, choice := range resp.Choices {
+		if choice.Index < 0 || choice.Index >= len(states) {
+			return nil, fmt.Errorf("choice index %d out of range", choice.Index)
+		}
+		candidate := &answerState{results: append([]*params.ModerationResult(nil), state.results...)}
+		if _, err := chat.updateOutput(ctx, candidate, choice.Message.Content, true); err != nil {
+			return nil, err
+		}
+		states[choice.Index] = candidate
+	}
+	for i, v := range states {
+		if v == nil {
+			return nil, fmt.Errorf("choice %d missing in response", i)
+		}
+	}
+	return states, nil
+}
+
+// index of the candidate kept in the history
+func (chat *ChatGPTConversion) selectChoice(states []*answerState) int {
+	if chat.choiceSelector == nil || len(states) == 1 {
+		return 0
+	}
+	shown := make([]string, len(states))
+	for i, v := range states {
+		shown[i] = v.shown
+	}
+	index := chat.choiceSelector(shown)
+	if index < 0 || index >= len(states) {
+		return 0
+	}
+	return index
+}
+
+// keep another candidate of a non-streamed answer with n > 1 in the history, its text is kept
+// after output moderation like the answer. Other answers have no candidates and return an error.
+func (chat *ChatGPTConversion) SelectChoice(msgId string, index int) error {
+	return chat.requst.SelectChoice(msgId, index)
+}
@@ -0,0 +1,73 @@
+package chatgpt
+
+import (
+	"context"
+	"testing"
+
+	"github.com/billikeu/go-chatgpt/moderation"
+	"github.com/billikeu/go-chatgpt/params"
+	openai "github.com/sashabaranov/go-openai"
+)
+
+func TestSelectChoice(t *testing.T) {
+	s := newStubServer(t, func(req *openai.ChatCompletionRequest) string { return "call alice" })
+	chat := s.conversation()
+	chat.SetN(3, nil)
+	chat.SetModeration(nil, moderation.NewRuleEngine(moderation.Rule{Name: "name", Keywords: []string{"alice"}, Action: moderation.ActionRedact}))
+
+	var last *params.Answer
+	if err := chat.Ask(context.Background(), "hi", func(answer *params.Answer, err error) {
+		if err == nil {
+			last = answer
+		}
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if len(s.chatRequests()) != 1 || s.chatRequests()[0].N != 3 || s.chatRequests()[0].Stream {
+		t.Fatalf("requests = %+v", s.chatRequests())
+	}
+	if last == nil || len(last.Candidates) != 3 || last.Candidates[2] != "call [redacted] (2)" {
+		t.Fatalf("answer = %+v", last)
+	}
+	if err := chat.SelectChoice(last.MsgId, 2); err != nil {
+		t.Fatal(err)
+	}
+	// the moderated candidate is kept, not the raw choice
+	if got := chat.Request().Msgs()[0].Answer(); got != "call [redacted] (2)" {
+		t.Errorf("selected answer = %q", got)
+	}
+	if err := chat.SelectChoice(last.MsgId, 3); err == nil {
+		t.Errorf("SelectChoice out of range succeeded")
+	}
+	if err := chat.SelectChoice("unknown", 0); err == nil {
+		t.Errorf("SelectChoice of an unknown message succeeded")
+	}
+}
+
+func TestSelectChoiceWithoutCandidates(t *testing.T) {
+	s := newStubServer(t, func(req *openai.ChatCompletionRequest) string { return "a streamed answer" })
+	chat := s.conversation()
+
+	var msgId string
+	if err := chat.Ask(context.Background(), "hi", func(answer *params.Answer, err error) {
+		if err == nil {
+			msgId = answer.MsgId
+		}
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := chat.SelectChoice(msgId, 0); err == nil {
+		t.Errorf("SelectChoice of a streamed answer succeeded")
+	}
+
+	// a stopped answer
+	req := chat.Request()
+	turn := req.Begin(NewChatMsg(openai.ChatMessageRoleUser, "again", ""))
+	req.CommitTruncated(turn, "a part", params.FinishReasonStopped)
+	if err := chat.SelectChoice(turn.MsgId(), 0); err == nil {
+		t.Errorf("SelectChoice of a truncated answer succeeded")
+	}
+	if got := req.Msgs()[1].Answer(); got != "a part" {
+		t.Errorf("truncated answer = %q", got)
+	}
+}
@@ -0,0 +1,46 @@
+package chatgpt
+
+import (
+	"context"
+	"errors"
+)
+
+// returned by Ask with PolicyReject while another Ask of the conversation runs
+var ErrConversationBusy = errors.New("conversation is busy")
+
+// what an Ask does while another Ask of the same conversation runs
+type ConcurrencyPolicy int
+
+const (
+	// wait until the running Ask is done or ctx is done
+	PolicyQueue ConcurrencyPolicy = iota
+	// return ErrConversationBusy
+	PolicyReject
+)
+
+// set the policy of concurrent Ask calls, default PolicyQueue
+func (chat *ChatGPTConversion) SetConcurrencyPolicy(policy ConcurrencyPolicy) {
+	chat.policy = policy
+}
+
+// acquire the conversation for one Ask
+func (chat *ChatGPTConversion) acquire(ctx context.Context) error {
+	if chat.policy == PolicyReject {
+		select {
+		case chat.busy <- struct{}{}:
+			return nil
+		default:
+			return ErrConversationBusy
+		}
+	}
+	select {
+	case chat.busy <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (chat *ChatGPTConversion) release() {
+	<-chat.busy
+}
@@ -0,0 +1,97 @@
+package chatgpt
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/billikeu/go-chatgpt/params"
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// a stub whose first chat request waits for release, entered is closed when it arrives
+func blockingStub(t *testing.T) (s *stubServer, entered, release chan struct{}) {
+	s = newStubServer(t, func(req *openai.ChatCompletionRequest) string { return "answer to " + lastUserContent(req) })
+	entered, release = make(chan struct{}), make(chan struct{})
+	s.before = func(r *http.Request) {
+		if len(s.chatRequests()) == 1 {
+			close(entered)
+			<-release
+		}
+	}
+	return s, entered, release
+}
+
+func TestConcurrencyReject(t *testing.T) {
+	s, entered, release := blockingStub(t)
+	chat := s.conversation()
+	chat.SetConcurrencyPolicy(PolicyReject)
+
+	first := make(chan error)
+	go func() {
+		first <- chat.Ask(context.Background(), "first", nil)
+	}()
+	<-entered
+	var callbackErr error
+	err := chat.Ask(context.Background(), "second", func(answer *params.Answer, err error) { callbackErr = err })
+	if !errors.Is(err, ErrConversationBusy) || callbackErr != err {
+		t.Errorf("Ask while busy = %v, callback got %v", err, callbackErr)
+	}
+	close(release)
+	if err := <-first; err != nil {
+		t.Fatal(err)
+	}
+	// the conversation is free again
+	if err := chat.Ask(context.Background(), "third", nil); err != nil {
+		t.Errorf("Ask after the running one = %v", err)
+	}
+	msgs := chat.Request().Msgs()
+	if len(msgs) != 2 || msgs[0].Request().Content != "first" || msgs[1].Request().Content != "third" {
+		t.Errorf("history = %+v", chat.Request().History())
+	}
+}
+
+func TestConcurrencyQueue(t *testing.T) {
+	s, entered, release := blockingStub(t)
+	chat := s.conversation()
+
+	first := make(chan error)
+	go func() {
+		first <- chat.Ask(context.Background(), "first", nil)
+	}()
+	<-entered
+
+	// a queued Ask gives up with its ctx
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := chat.Ask(ctx, "impatient", nil); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("queued Ask with a done ctx = %v", err)
+	}
+
+	second := make(chan error)
+	go func() {
+		second <- chat.Ask(context.Background(), "second", nil)
+	}()
+	time.Sleep(20 * time.Millisecond)
+	if n := len(s.chatRequests()); n != 1 {
+		t.Errorf("%d requests while the first Ask runs", n)
+	}
+	close(release)
+	if err := <-first; err != nil {
+		t.Fatal(err)
+	}
+	if err := <-second; err != nil {
+		t.Fatal(err)
+	}
+	// the queued Ask runs after the first one and sees its answer
+	reqs := s.chatRequests()
+	if len(reqs) != 2 || len(reqs[1].Messages) != 3 || reqs[1].Messages[1].Content != "answer to first" {
+		t.Errorf("requests = %+v", reqs)
+	}
+	msgs := chat.Request().Msgs()
+	if len(msgs) != 2 || msgs[0].Request().Content != "first" || msgs[1].Request().Content != "second" {
+		t.Errorf("history = %+v", chat.Request().History())
+	}
+}
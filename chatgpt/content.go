@@ -0,0 +1,216 @@
+package chatgpt
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// content part types
+const (
+	PartText     = "text"
+	PartImageURL = "image_url"
+)
+
+// a part of a multi-part user message: text or an image url (http(s) or data url)
+type ContentPart struct {
+	Type     string
+	Text     string
+	ImageURL string
+	Detail   string // auto, low or high, empty: auto
+}
+
+func TextPart(text string) ContentPart {
+	return ContentPart{Type: PartText, Text: text}
+}
+
+func ImageURLPart(url, detail string) ContentPart {
+	return ContentPart{Type: PartImageURL, ImageURL: url, Detail: detail}
+}
+
+// image types accepted by the vision models
+var imageTypes = map[string]bool{
+	"image/png":  true,
+	"image/jpeg": true,
+	"image/gif":  true,
+	"image/webp": true,
+}
+
+// read a local png, jpeg, gif or webp file as a data url, maxBytes <= 0: DefaultImageLimits.MaxBytes
+func ImageFilePart(path, detail string, maxBytes int) (ContentPart, error) {
+	if maxBytes <= 0 {
+		maxBytes = DefaultImageLimits.MaxBytes
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return ContentPart{}, err
+	}
+	if info.Size() > int64(maxBytes) {
+		return ContentPart{}, fmt.Errorf("image %s is %d bytes, limit %d", filepath.Base(path), info.Size(), maxBytes)
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return ContentPart{}, err
+	}
+	mime := http.DetectContentType(b)
+	if !imageTypes[mime] {
+		return ContentPart{}, fmt.Errorf("image %s has unsupported type %s", filepath.Base(path), mime)
+	}
+	return ImageURLPart("data:"+mime+";base64,"+base64.StdEncoding.EncodeToString(b), detail), nil
+}
+
+// size limits of images sent by AskParts
+type ImageLimits struct {
+	MaxBytes      int // decoded size of a data url image
+	MaxPerMessage int
+	// images of the last HistoryMessages user messages are sent, older ones are replaced by a placeholder, 0: all
+	HistoryMessages int
+}
+
+var DefaultImageLimits = ImageLimits{
+	MaxBytes:      20 << 20,
+	MaxPerMessage: 10,
+}
+
+// check parts against limits
+func (limits ImageLimits) check(parts []ContentPart) error {
+	var images int
+	for i, v := range parts {
+		switch v.Type {
+		case PartText:
+		case PartImageURL:
+			images++
+			if err := limits.checkURL(v.ImageURL); err != nil {
+				return fmt.Errorf("part %d: %s", i, err.Error())
+			}
+		default:
+			return fmt.Errorf("part %d: unknown type %q", i, v.Type)
+		}
+	}
+	if limits.MaxPerMessage > 0 && images > limits.MaxPerMessage {
+		return fmt.Errorf("%d images in a message, limit %d", images, limits.MaxPerMessage)
+	}
+	return nil
+}
+
+func (limits ImageLimits) checkURL(url string) error {
+	switch {
+	case strings.HasPrefix(url, "http://"), strings.HasPrefix(url, "https://"):
+		return nil
+	case strings.HasPrefix(url, "data:"):
+		header, data, ok := strings.Cut(url, ",")
+		if !ok || !strings.HasSuffix(header, ";base64") {
+			return fmt.Errorf("invalid data url")
+		}
+		mime := strings.TrimSuffix(strings.TrimPrefix(header, "data:"), ";base64")
+		if !imageTypes[mime] {
+			return fmt.Errorf("unsupported image type %s", mime)
+		}
+		if size := base64.StdEncoding.DecodedLen(len(data)); limits.MaxBytes > 0 && size > limits.MaxBytes {
+			return fmt.Errorf("image is %d bytes, limit %d", size, limits.MaxBytes)
+		}
+		return nil
+	default:
+		return fmt.Errorf("image url must be http(s) or a data url")
+	}
+}
+
+// parts are a single text
+func isPlainText(parts []ContentPart) bool {
+	return len(parts) == 1 && parts[0].Type == PartText
+}
+
+// the text parts joined by new lines
+func partsText(parts []ContentPart) string {
+	var texts []string
+	for _, v := range parts {
+		if v.Type == PartText {
+			texts = append(texts, v.Text)
+		}
+	}
+	return strings.Join(texts, "\n")
+}
+
+func toMessageParts(parts []ContentPart) []openai.ChatMessagePart {
+	out := make([]openai.ChatMessagePart, 0, len(parts))
+	for _, v := range parts {
+		if v.Type == PartImageURL {
+			out = append(out, openai.ChatMessagePart{
+				Type:     openai.ChatMessagePartTypeImageURL,
+				ImageURL: &openai.ChatMessageImageURL{URL: v.ImageURL, Detail: openai.ImageURLDetail(v.Detail)},
+			})
+			continue
+		}
+		out = append(out, openai.ChatMessagePart{Type: openai.ChatMessagePartTypeText, Text: v.Text})
+	}
+	return out
+}
+
+const imagePlaceholder = "[image]"
+
+// the text of a message, images are written as [image]
+func messageText(msg openai.ChatCompletionMessage) string {
+	if len(msg.MultiContent) == 0 {
+		return msg.Content
+	}
+	var texts []string
+	for _, v := range msg.MultiContent {
+		if v.Type == openai.ChatMessagePartTypeImageURL {
+			texts = append(texts, imagePlaceholder)
+			continue
+		}
+		texts = append(texts, v.Text)
+	}
+	return strings.Join(texts, "\n")
+}
+
+// msg without its images
+func withoutImages(msg openai.ChatCompletionMessage) openai.ChatCompletionMessage {
+	parts := make([]openai.ChatMessagePart, 0, len(msg.MultiContent))
+	for _, v := range msg.MultiContent {
+		if v.Type == openai.ChatMessagePartTypeImageURL {
+			v = openai.ChatMessagePart{Type: openai.ChatMessagePartTypeText, Text: imagePlaceholder}
+		}
+		parts = append(parts, v)
+	}
+	msg.MultiContent = parts
+	return msg
+}
+
+func hasImages(msg openai.ChatCompletionMessage) bool {
+	for _, v := range msg.MultiContent {
+		if v.Type == openai.ChatMessagePartTypeImageURL {
+			return true
+		}
+	}
+	return false
+}
+
+// short stable id of an image url for cache keys
+func imageDigest(url string) string {
+	sum := sha256.Sum256([]byte(url))
+	return hex.EncodeToString(sum[:8])
+}
+
+/*
+set image limits of AskParts, zero fields use DefaultImageLimits
+
+	chat.SetImageLimits(chatgpt.ImageLimits{MaxBytes: 5 << 20, HistoryMessages: 2})
+*/
+func (chat *ChatGPTConversion) SetImageLimits(limits ImageLimits) {
+	if limits.MaxBytes <= 0 {
+		limits.MaxBytes = DefaultImageLimits.MaxBytes
+	}
+	if limits.MaxPerMessage <= 0 {
+		limits.MaxPerMessage = DefaultImageLimits.MaxPerMessage
+	}
+	chat.imageLimits = limits
+	chat.requst.SetHistoryImages(limits.HistoryMessages)
+}
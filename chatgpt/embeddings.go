@@ -0,0 +1,296 @@
+package chatgpt
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/billikeu/go-chatgpt/common"
+	"github.com/billikeu/go-chatgpt/vector"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// turns texts into embedding vectors, implemented by ChatGPTConversion and EmbeddingClient
+type Embedder interface {
+	Embed(ctx context.Context, inputs []string) ([][]float32, error)
+}
+
+/*
+EmbeddingClient calls the embeddings API with the same config, proxy and base URL handling as ChatGPTConversion.
+Inputs are sent in batches, texts longer than the input limit are split and their vectors averaged.
+
+	client := chatgpt.NewEmbeddingClient("sk-...")
+	client.SetProxy("socks5://127.0.0.1:3126")
+	client.Init()
+	vectors, err := client.Embed(ctx, texts)
+*/
+type EmbeddingClient struct {
+	secretKey string
+	config    openai.ClientConfig
+	client    *openai.Client
+	http      httpSettings
+
+	model       openai.EmbeddingModel
+	batchSize   int
+	maxTokens   int
+	concurrency int
+}
+
+func NewEmbeddingClient(secretKey string) *EmbeddingClient {
+	c := newEmbeddingClient(openai.DefaultConfig(secretKey))
+	c.secretKey = secretKey
+	return c
+}
+
+func newEmbeddingClient(config openai.ClientConfig) *EmbeddingClient {
+	return &EmbeddingClient{
+		config:      config,
+		model:       openai.AdaEmbeddingV2,
+		batchSize:   100,
+		maxTokens:   8000,
+		concurrency: 4,
+	}
+}
+
+/*
+set proxy
+client.SetProxy("socks5://127.0.0.1:3126")
+client.SetProxy("http://127.0.0.1:3127")
+*/
+func (c *EmbeddingClient) SetProxy(proxy string) error {
+	settings := c.http
+	settings.proxy = proxy
+	return c.setHTTP(settings)
+}
+
+// send every request through the next proxy of pool, it replaces SetProxy
+func (c *EmbeddingClient) SetProxyPool(pool *common.ProxyPool) error {
+	settings := c.http
+	settings.proxyPool = pool
+	return c.setHTTP(settings)
+}
+
+// set the base http client, the proxy is composed on top of its transport
+func (c *EmbeddingClient) SetHTTPClient(client *http.Client) error {
+	settings := c.http
+	settings.client = client
+	return c.setHTTP(settings)
+}
+
+// set the base transport, it replaces the transport of SetHTTPClient; a proxy needs an *http.Transport
+func (c *EmbeddingClient) SetTransport(transport http.RoundTripper) error {
+	settings := c.http
+	settings.transport = transport
+	return c.setHTTP(settings)
+}
+
+func (c *EmbeddingClient) setHTTP(settings httpSettings) error {
+	if err := settings.apply(&c.config); err != nil {
+		return err
+	}
+	c.http = settings
+	// an initialized client is rebuilt with the settings
+	if c.client != nil {
+		return c.Init()
+	}
+	return nil
+}
+
+// set base URL, default openai URL
+func (c *EmbeddingClient) SetBaseURL(baseURL string) {
+	if baseURL != "" {
+		c.config.BaseURL = baseURL
+	}
+}
+
+// set embedding model, default text-embedding-ada-002
+func (c *EmbeddingClient) SetModel(model openai.EmbeddingModel) {
+	c.model = model
+}
+
+// set inputs per request, default 100
+func (c *EmbeddingClient) SetBatchSize(batchSize int) {
+	if batchSize > 0 {
+		c.batchSize = batchSize
+	}
+}
+
+// set the estimated token limit of one input, longer texts are split, default 8000
+func (c *EmbeddingClient) SetMaxInputTokens(maxTokens int) {
+	if maxTokens > 0 {
+		c.maxTokens = maxTokens
+	}
+}
+
+// set concurrent requests of one Embed call, default 4
+func (c *EmbeddingClient) SetConcurrency(concurrency int) {
+	if concurrency > 0 {
+		c.concurrency = concurrency
+	}
+}
+
+// init client
+func (c *EmbeddingClient) Init() error {
+	c.client = openai.NewClientWithConfig(c.config)
+	return nil
+}
+
+// embed inputs, one vector per input
+func (c *EmbeddingClient) Embed(ctx context.Context, inputs []string) ([][]float32, error) {
+	if c.client == nil {
+		return nil, errors.New("embedding client is not initialized")
+	}
+	if len(inputs) == 0 {
+		return nil, nil
+	}
+	// split long inputs, owners[i] is the input of piece i
+	var pieces []string
+	var owners []int
+	for i, input := range inputs {
+		for _, piece := range splitText(input, c.maxTokens) {
+			pieces = append(pieces, piece)
+			owners = append(owners, i)
+		}
+	}
+
+	vectors := make([][]float32, len(pieces))
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	sem := make(chan struct{}, c.concurrency)
+	var wg sync.WaitGroup
+	var once sync.Once
+	var firstErr error
+	for start := 0; start < len(pieces); start += c.batchSize {
+		end := start + c.batchSize
+		if end > len(pieces) {
+			end = len(pieces)
+		}
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		wg.Add(1)
+		go func(start, end int) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			err := c.embedBatch(ctx, pieces[start:end], vectors[start:end])
+			if err != nil {
+				once.Do(func() {
+					firstErr = err
+					cancel()
+				})
+			}
+		}(start, end)
+	}
+	wg.Wait()
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(pieces) == len(inputs) {
+		return vectors, nil
+	}
+	// average the pieces of a split input weighted by their length
+	result := make([][]float32, len(inputs))
+	for i, vec := range vectors {
+		owner := owners[i]
+		weight := float32(common.EstimateTokens(pieces[i]) + 1)
+		if result[owner] == nil {
+			result[owner] = make([]float32, len(vec))
+		} else if len(result[owner]) != len(vec) {
+			return nil, errors.New("embedding dimensions do not match")
+		}
+		for j, v := range vec {
+			result[owner][j] += weight * v
+		}
+	}
+	for i, vec := range result {
+		result[i] = vector.Normalize(vec)
+	}
+	return result, nil
+}
+
+func (c *EmbeddingClient) embedBatch(ctx context.Context, inputs []string, out [][]float32) error {
+	resp, err := c.client.CreateEmbeddings(ctx, openai.EmbeddingRequest{
+		Input: inputs,
+		Model: c.model,
+	})
+	if err != nil {
+		return err
+	}
+	if len(resp.Data) != len(inputs) {
+		return errors.New("embeddings count does not match inputs")
+	}
+	for _, v := range resp.Data {
+		if v.Index < 0 || v.Index >= len(out) {
+			return errors.New("embedding index out of range")
+		}
+		out[v.Index] = v.Embedding
+	}
+	return nil
+}
+
+// split text at whitespace into pieces of at most maxTokens estimated tokens
+func splitText(text string, maxTokens int) []string {
+	if common.EstimateTokens(text) <= maxTokens {
+		return []string{text}
+	}
+	var pieces []string
+	var b strings.Builder
+	tokens := 0
+	for _, word := range strings.Fields(text) {
+		n := common.EstimateTokens(word) + 1
+		if tokens+n > maxTokens && b.Len() > 0 {
+			pieces = append(pieces, b.String())
+			b.Reset()
+			tokens = 0
+		}
+		// a single word above the limit is cut by runes
+		for n > maxTokens {
+			runes := []rune(word)
+			cut := len(runes) * maxTokens / n
+			if cut == 0 {
+				cut = 1
+			}
+			pieces = append(pieces, string(runes[:cut]))
+			word = string(runes[cut:])
+			n = common.EstimateTokens(word) + 1
+		}
+		if b.Len() > 0 {
+			b.WriteByte(' ')
+		}
+		b.WriteString(word)
+		tokens += n
+	}
+	if b.Len() > 0 {
+		pieces = append(pieces, b.String())
+	}
+	return pieces
+}
+
+/*
+the embedding client used by Embed, Init copies the config of the conversation into it.
+Use it to change batch size, input limit and concurrency.
+*/
+func (chat *ChatGPTConversion) EmbeddingClient() *EmbeddingClient {
+	return chat.embeddings
+}
+
+// set embedding model, default text-embedding-ada-002
+func (chat *ChatGPTConversion) SetEmbeddingModel(model openai.EmbeddingModel) {
+	chat.embeddings.SetModel(model)
+}
+
+// embed inputs with the client settings of the conversation, one vector per input
+func (chat *ChatGPTConversion) Embed(ctx context.Context, inputs []string) ([][]float32, error) {
+	return chat.embeddings.Embed(ctx, inputs)
+}
@@ -0,0 +1,119 @@
+package chatgpt
+
+import (
+	"context"
+	"math"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/billikeu/go-chatgpt/common"
+	openai "github.com/sashabaranov/go-openai"
+)
+
+func stubEmbeddingClient(s *stubServer) *EmbeddingClient {
+	c := NewEmbeddingClient("sk-test")
+	c.SetBaseURL(s.URL + "/v1")
+	c.Init()
+	return c
+}
+
+func TestEmbedBatches(t *testing.T) {
+	s := newStubServer(t, func(req *openai.ChatCompletionRequest) string { return "" })
+	c := stubEmbeddingClient(s)
+	c.SetBatchSize(2)
+	c.SetConcurrency(2)
+
+	inputs := []string{"a", "bb", "ccc", "dddd", "eeeee"}
+	vectors, err := c.Embed(context.Background(), inputs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// one vector per input in the order of inputs, the stub sends them in reverse
+	if len(vectors) != len(inputs) {
+		t.Fatalf("%d vectors", len(vectors))
+	}
+	for i, v := range vectors {
+		if len(v) != 2 || int(v[0]) != len(inputs[i]) {
+			t.Errorf("vector %d = %v", i, v)
+		}
+	}
+	var batches []string
+	for _, v := range s.embeddings {
+		batches = append(batches, strings.Join(v, ","))
+	}
+	sort.Strings(batches)
+	if strings.Join(batches, " ") != "a,bb ccc,dddd eeeee" {
+		t.Errorf("batches = %q", batches)
+	}
+
+	if vectors, err := c.Embed(context.Background(), nil); err != nil || vectors != nil {
+		t.Errorf("Embed of no inputs = %v, %v", vectors, err)
+	}
+	if _, err := NewEmbeddingClient("sk-test").Embed(context.Background(), inputs); err == nil {
+		t.Errorf("Embed without Init succeeded")
+	}
+}
+
+func TestEmbedLongInput(t *testing.T) {
+	s := newStubServer(t, func(req *openai.ChatCompletionRequest) string { return "" })
+	c := stubEmbeddingClient(s)
+	c.SetMaxInputTokens(4)
+
+	long := strings.Repeat("word ", 10)
+	vectors, err := c.Embed(context.Background(), []string{"short", long})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(s.embeddings) != 1 || len(s.embeddings[0]) < 3 || s.embeddings[0][0] != "short" {
+		t.Fatalf("sent %q", s.embeddings)
+	}
+	// the pieces of a split input are averaged into one unit vector
+	if len(vectors) != 2 {
+		t.Fatalf("%d vectors", len(vectors))
+	}
+	norm := math.Hypot(float64(vectors[1][0]), float64(vectors[1][1]))
+	if math.Abs(norm-1) > 1e-5 {
+		t.Errorf("vector of the split input %v has norm %f", vectors[1], norm)
+	}
+}
+
+func TestSplitText(t *testing.T) {
+	tests := []struct {
+		name      string
+		text      string
+		maxTokens int
+		pieces    int  // 0: more than one
+		cut       bool // a word is cut, pieces join without spaces
+	}{
+		{"fits", "one two  three", 10, 1, false},
+		{"exact limit", strings.Repeat("x", 40), 10, 1, false},
+		{"words", strings.Repeat("word ", 40), 10, 0, false},
+		{"long word", strings.Repeat("x", 100), 5, 0, true},
+		{"long cjk word", strings.Repeat("字", 30), 8, 0, true},
+	}
+	for _, tt := range tests {
+		pieces := splitText(tt.text, tt.maxTokens)
+		if tt.pieces > 0 {
+			if len(pieces) != tt.pieces || pieces[0] != tt.text {
+				t.Errorf("%s: pieces = %q", tt.name, pieces)
+			}
+			continue
+		}
+		if len(pieces) < 2 {
+			t.Errorf("%s: not split", tt.name)
+		}
+		for i, p := range pieces {
+			if n := common.EstimateTokens(p); n > tt.maxTokens || p == "" {
+				t.Errorf("%s: piece %d %q has %d tokens, limit %d", tt.name, i, p, n, tt.maxTokens)
+			}
+		}
+		// nothing is lost
+		if tt.cut && strings.Join(pieces, "") != tt.text {
+			t.Errorf("%s: pieces %q lose text", tt.name, pieces)
+		}
+		if !tt.cut && strings.Join(pieces, " ") != strings.Join(strings.Fields(tt.text), " ") {
+			t.Errorf("%s: pieces %q lose words", tt.name, pieces)
+		}
+	}
+}
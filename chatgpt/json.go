@@ -0,0 +1,260 @@
+package chatgpt
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/billikeu/go-chatgpt/common"
+	"github.com/billikeu/go-chatgpt/params"
+)
+
+// options of AskJSON
+type JSONOptions[T any] struct {
+	// re-asks with the validation error after an invalid answer, default 2, < 0: none
+	MaxRetries int
+	// do not send response_format json_object even if the model supports it
+	DisableJSONMode bool
+	// called with the streamed answer parsed so far, fields not received yet are zero
+	OnPartial func(partial T)
+}
+
+// the answer is not valid json of the schema after all retries
+type JSONError struct {
+	Text string // the last answer
+	Err  error
+}
+
+func (e *JSONError) Error() string {
+	return "invalid json answer: " + e.Err.Error()
+}
+
+func (e *JSONError) Unwrap() error {
+	return e.Err
+}
+
+// models with response_format json_object
+var jsonModeModels = []string{"gpt-4o", "gpt-4-turbo", "gpt-4-1106", "gpt-4-0125", "gpt-3.5-turbo-1106", "gpt-3.5-turbo-0125"}
+
+func supportsJSONMode(model string) bool {
+	if model == "gpt-3.5-turbo" {
+		return true
+	}
+	for _, v := range jsonModeModels {
+		if strings.HasPrefix(model, v) {
+			return true
+		}
+	}
+	return false
+}
+
+/*
+AskJSON asks for an answer as json matching T: the schema derived from T is sent with the prompt,
+the streamed text is parsed incrementally and the answer is validated against the schema.
+An invalid answer is re-asked with the validation error, the history only keeps the prompt
+with the valid answer.
+
+	weather, err := chatgpt.AskJSON(ctx, conversation, "Weather in Paris?", &chatgpt.JSONOptions[Weather]{
+		OnPartial: func(partial Weather) { log.Println(partial.City) },
+	})
+*/
+func AskJSON[T any](ctx context.Context, chat *ChatGPTConversion, prompt string, opts *JSONOptions[T]) (T, error) {
+	var result T
+	if opts == nil {
+		opts = &JSONOptions[T]{}
+	}
+	maxRetries := opts.MaxRetries
+	if maxRetries == 0 {
+		maxRetries = 2
+	}
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	ctx = common.EnsureRequestId(ctx)
+	ctx, span := chat.tracer.Start(ctx, "chatgpt.AskJSON", common.Attribute(common.AttrBackend, common.BackendChatGPT))
+	var err error
+	defer func() {
+		common.EndSpan(span, err)
+	}()
+
+	schema := SchemaOf(reflect.TypeOf(&result).Elem())
+	// retries are sent after the invalid answers, only the valid turn is committed
+	var turn *Turn
+	var pending []*ChatMsg
+	askOpts := askOptions{
+		// json mode only returns objects
+		jsonMode: !opts.DisableJSONMode && schema.Type == "object" && supportsJSONMode(chat.model),
+		deferred: true,
+		began:    func(t *Turn) { turn = t },
+	}
+	question := fmt.Sprintf("%s\n\nReply with only a JSON value, without markdown, that matches this JSON schema:\n%s", prompt, schema.String())
+	for retry := 0; ; retry++ {
+		var text string
+		var last string
+		askOpts.pending = pending
+		err = chat.ask(ctx, []ContentPart{TextPart(question)}, askOpts, func(answer *params.Answer, err error) {
+			if answer == nil || err != nil {
+				return
+			}
+			text = answer.Text
+			if opts.OnPartial == nil || answer.Done {
+				return
+			}
+			partial, ok := RepairJSON(extractJSON(text, schema.scalar()))
+			if !ok || partial == last {
+				return
+			}
+			last = partial
+			var v T
+			if json.Unmarshal([]byte(partial), &v) == nil {
+				opts.OnPartial(v)
+			}
+		})
+		if err != nil {
+			return result, err
+		}
+		var invalid error
+		result, invalid = decodeJSON[T](schema, text)
+		if invalid == nil {
+			chat.requst.commitDeferred(turn)
+			return result, nil
+		}
+		if retry >= maxRetries {
+			err = &JSONError{Text: text, Err: invalid}
+			return result, err
+		}
+		chat.metrics.IncRetry(common.BackendChatGPT)
+		span.SetAttributes(common.Attribute(common.AttrRetryCount, retry+1))
+		chat.logger.Warn(ctx, "invalid json answer, retrying", "retry", retry+1, "err", invalid)
+		pending = append(pending, turn.msg)
+		question = fmt.Sprintf("Your answer is not valid: %s\nReply with only the corrected JSON value.", invalid.Error())
+	}
+}
+
+// parse and validate an answer
+func decodeJSON[T any](schema *Schema, text string) (T, error) {
+	var result T
+	raw := extractJSON(text, schema.scalar())
+	if raw == "" {
+		return result, errors.New("no json value found")
+	}
+	var value interface{}
+	if err := json.Unmarshal([]byte(raw), &value); err != nil {
+		return result, err
+	}
+	if err := schema.Validate(value); err != nil {
+		return result, err
+	}
+	if err := json.Unmarshal([]byte(raw), &result); err != nil {
+		return result, err
+	}
+	return result, nil
+}
+
+// the json value of an answer, without markdown fences and text around it.
+// A scalar value is read from the start, text before an object or array is skipped.
+func extractJSON(text string, scalar bool) string {
+	text = strings.TrimSpace(text)
+	if strings.HasPrefix(text, "```") {
+		text = strings.TrimPrefix(text, "```json")
+		text = strings.TrimPrefix(text, "```")
+		if i := strings.LastIndex(text, "```"); i >= 0 {
+			text = text[:i]
+		}
+	}
+	if !scalar {
+		start := strings.IndexAny(text, "{[")
+		if start < 0 {
+			return ""
+		}
+		text = text[start:]
+	}
+	// drop text after a complete value
+	dec := json.NewDecoder(strings.NewReader(text))
+	var raw json.RawMessage
+	if dec.Decode(&raw) == nil {
+		return string(raw)
+	}
+	return strings.TrimSpace(text)
+}
+
+/*
+RepairJSON completes a truncated json text, for parsing a streamed answer:
+open strings, arrays and objects are closed and an incomplete last member is dropped.
+
+	RepairJSON(`{"city": "Par`)          // {"city": "Par"}
+	RepairJSON(`{"city": "Paris", "te`)  // {"city": "Paris"}
+*/
+func RepairJSON(text string) (string, bool) {
+	text = strings.TrimSpace(text)
+	for text != "" {
+		stack, inString, escaped, cuts := scanJSON(text)
+		candidate := text
+		if inString {
+			if escaped {
+				candidate = candidate[:len(candidate)-1]
+			}
+			candidate += `"`
+		}
+		candidate = strings.TrimSpace(candidate)
+		var b strings.Builder
+		b.WriteString(candidate)
+		for i := len(stack) - 1; i >= 0; i-- {
+			if stack[i] == '{' {
+				b.WriteByte('}')
+			} else {
+				b.WriteByte(']')
+			}
+		}
+		if json.Valid([]byte(b.String())) {
+			return b.String(), true
+		}
+		cut := -1
+		for i := len(cuts) - 1; i >= 0; i-- {
+			if cuts[i] < len(text) {
+				cut = cuts[i]
+				break
+			}
+		}
+		if cut < 0 {
+			return "", false
+		}
+		text = strings.TrimSpace(text[:cut])
+	}
+	return "", false
+}
+
+// scan text for open brackets and cut points: before a comma, after an opening bracket
+func scanJSON(text string) (stack []byte, inString, escaped bool, cuts []int) {
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		if inString {
+			switch {
+			case escaped:
+				escaped = false
+			case c == '\\':
+				escaped = true
+			case c == '"':
+				inString = false
+			}
+			continue
+		}
+		switch c {
+		case '"':
+			inString = true
+		case '{', '[':
+			stack = append(stack, c)
+			cuts = append(cuts, i+1)
+		case '}', ']':
+			if len(stack) > 0 {
+				stack = stack[:len(stack)-1]
+			}
+		case ',':
+			cuts = append(cuts, i)
+		}
+	}
+	return stack, inString, escaped, cuts
+}
@@ -0,0 +1,209 @@
+package chatgpt
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+func TestRepairJSON(t *testing.T) {
+	tests := []struct {
+		text string
+		want string
+		ok   bool
+	}{
+		{`{"city": "Paris"}`, `{"city": "Paris"}`, true},
+		{`{"city": "Par`, `{"city": "Par"}`, true},
+		{`{"city": "Paris", "te`, `{"city": "Paris"}`, true},
+		{`{"city": "Paris", "temp": `, `{"city": "Paris"}`, true},
+		{`{"city": "Paris", "temp": 2`, `{"city": "Paris", "temp": 2}`, true},
+		{`{"days": [1, 2`, `{"days": [1, 2]}`, true},
+		{`{"days": [{"t": 1}, {"t"`, `{"days": [{"t": 1}, {}]}`, true},
+		{`{"quote": "a \"b`, `{"quote": "a \"b"}`, true},
+		{`{"path": "C:\`, `{"path": "C:"}`, true},
+		{`[`, `[]`, true},
+		{`{`, `{}`, true},
+		{`[1, 2, 3]`, `[1, 2, 3]`, true},
+		{``, ``, false},
+		{`Paris`, ``, false},
+	}
+	for _, tt := range tests {
+		got, ok := RepairJSON(tt.text)
+		if ok != tt.ok || got != tt.want {
+			t.Errorf("RepairJSON(%q) = %q, %v, want %q, %v", tt.text, got, ok, tt.want, tt.ok)
+		}
+		if ok && !json.Valid([]byte(got)) {
+			t.Errorf("RepairJSON(%q) = %q is not valid json", tt.text, got)
+		}
+	}
+}
+
+func TestExtractJSON(t *testing.T) {
+	tests := []struct {
+		text   string
+		scalar bool
+		want   string
+	}{
+		{`{"a":1}`, false, `{"a":1}`},
+		{"```json\n{\"a\":1}\n```", false, `{"a":1}`},
+		{"```\n[1,2]\n```", false, `[1,2]`},
+		{`Sure! {"a":1} Hope this helps.`, false, `{"a":1}`},
+		{`{"a":1} {"b":2}`, false, `{"a":1}`},
+		{`{"a":`, false, `{"a":`},
+		{`no json here`, false, ``},
+		{` 42 `, true, `42`},
+		{"```json\n\"see [1]\"\n```", true, `"see [1]"`},
+		{`true, it is`, true, `true`},
+	}
+	for _, tt := range tests {
+		if got := extractJSON(tt.text, tt.scalar); got != tt.want {
+			t.Errorf("extractJSON(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
+
+type testWeather struct {
+	City    string            `json:"city" desc:"city name"`
+	Unit    string            `json:"unit" enum:"celsius,fahrenheit"`
+	Temp    float64           `json:"temp"`
+	Days    []int             `json:"days,omitempty"`
+	At      time.Time         `json:"at,omitempty"`
+	Tags    map[string]string `json:"tags,omitempty"`
+	Next    *testWeather      `json:"next,omitempty"`
+	Any     interface{}       `json:"any,omitempty"`
+	Ignored string            `json:"-"`
+	hidden  string
+}
+
+func TestSchemaOf(t *testing.T) {
+	s := SchemaOf(reflect.TypeOf(testWeather{}))
+	if s.Type != "object" || s.AdditionalProperties != false {
+		t.Fatalf("schema = %s", s)
+	}
+	if want := []string{"city", "temp", "unit"}; !reflect.DeepEqual(s.Required, want) {
+		t.Errorf("required = %v, want %v", s.Required, want)
+	}
+	if len(s.Properties) != 8 {
+		t.Errorf("properties = %d, want 8", len(s.Properties))
+	}
+	if p := s.Properties["city"]; p.Type != "string" || p.Description != "city name" {
+		t.Errorf("city = %s", p)
+	}
+	if p := s.Properties["unit"]; !reflect.DeepEqual(p.Enum, []string{"celsius", "fahrenheit"}) {
+		t.Errorf("unit = %s", p)
+	}
+	if p := s.Properties["days"]; p.Type != "array" || p.Items.Type != "integer" {
+		t.Errorf("days = %s", p)
+	}
+	if p := s.Properties["at"]; p.Type != "string" || p.Format != "date-time" {
+		t.Errorf("at = %s", p)
+	}
+	// recursive types end in a plain object
+	if p := s.Properties["next"]; p.Type != "object" || p.Properties != nil {
+		t.Errorf("next = %s", p)
+	}
+}
+
+func TestSchemaValidate(t *testing.T) {
+	s := SchemaOf(reflect.TypeOf(testWeather{}))
+	tests := []struct {
+		json string
+		err  string // "": valid
+	}{
+		{`{"city":"Paris","unit":"celsius","temp":21.5}`, ""},
+		{`{"city":"Paris","unit":"celsius","temp":21,"days":[1,2],"at":"2024-05-01T10:00:00Z","tags":{"a":"b"},"any":[1,"x"]}`, ""},
+		{`{"city":null,"unit":"celsius","temp":21}`, ""},
+		{`{"city":"Paris","unit":"celsius"}`, `$: missing required property "temp"`},
+		{`{"city":"Paris","unit":"kelvin","temp":21}`, `$.unit: "kelvin" is not one of celsius, fahrenheit`},
+		{`{"city":1,"unit":"celsius","temp":21}`, `$.city: want string, got number`},
+		{`{"city":"Paris","unit":"celsius","temp":"21"}`, `$.temp: want number, got string`},
+		{`{"city":"Paris","unit":"celsius","temp":21,"days":[1,2.5]}`, `$.days[1]: want integer, got 2.5`},
+		{`{"city":"Paris","unit":"celsius","temp":21,"at":"yesterday"}`, `$.at: "yesterday" is not a RFC 3339 date-time`},
+		{`{"city":"Paris","unit":"celsius","temp":21,"tags":{"a":1}}`, `$.tags.a: want string, got number`},
+		{`{"city":"Paris","unit":"celsius","temp":21,"wind":3}`, `$: unknown property "wind"`},
+		{`[1]`, `$: want object, got array`},
+	}
+	for _, tt := range tests {
+		var value interface{}
+		if err := json.Unmarshal([]byte(tt.json), &value); err != nil {
+			t.Fatalf("%s: %v", tt.json, err)
+		}
+		err := s.Validate(value)
+		got := ""
+		if err != nil {
+			got = err.Error()
+		}
+		if got != tt.err {
+			t.Errorf("Validate(%s) = %q, want %q", tt.json, got, tt.err)
+		}
+	}
+}
+
+func TestDecodeJSON(t *testing.T) {
+	s := SchemaOf(reflect.TypeOf(testWeather{}))
+	w, err := decodeJSON[testWeather](s, "```json\n{\"city\":\"Paris\",\"unit\":\"celsius\",\"temp\":21}\n```")
+	if err != nil || w.City != "Paris" || w.Temp != 21 {
+		t.Errorf("decodeJSON = %+v, %v", w, err)
+	}
+	if _, err := decodeJSON[testWeather](s, "I don't know"); err == nil || !strings.Contains(err.Error(), "no json value") {
+		t.Errorf("decodeJSON without json err = %v", err)
+	}
+	if _, err := decodeJSON[testWeather](s, `{"city":"Paris"}`); err == nil {
+		t.Errorf("decodeJSON accepted an invalid answer")
+	}
+}
+
+func TestAskJSONRetry(t *testing.T) {
+	s := newStubServer(t, func(req *openai.ChatCompletionRequest) string {
+		if strings.HasPrefix(lastUserContent(req), "Your answer is not valid") {
+			return `{"city":"Paris","unit":"celsius","temp":21}`
+		}
+		return `{"city":"Paris"}`
+	})
+	chat := s.conversation()
+	w, err := AskJSON[testWeather](context.Background(), chat, "Weather in Paris?", nil)
+	if err != nil || w.Temp != 21 {
+		t.Fatalf("AskJSON = %+v, %v", w, err)
+	}
+	reqs := s.chatRequests()
+	if len(reqs) != 2 {
+		t.Fatalf("%d requests", len(reqs))
+	}
+	// the retry is sent after the invalid answer
+	retry := reqs[1].Messages
+	if len(retry) != 3 || !strings.HasPrefix(retry[0].Content, "Weather in Paris?") || retry[1].Content != `{"city":"Paris"}` {
+		t.Errorf("retry messages = %+v", retry)
+	}
+	// only the prompt and the valid answer are kept
+	msgs := chat.Request().Msgs()
+	if len(msgs) != 1 || !strings.HasPrefix(msgs[0].Request().Content, "Weather in Paris?") || msgs[0].Answer() != `{"city":"Paris","unit":"celsius","temp":21}` {
+		t.Errorf("history = %+v", chat.Request().History())
+	}
+
+	// an answer that stays invalid leaves the history unchanged
+	s.reply = func(req *openai.ChatCompletionRequest) string { return "no idea" }
+	var jsonErr *JSONError
+	if _, err := AskJSON[testWeather](context.Background(), chat, "Weather in Rome?", &JSONOptions[testWeather]{MaxRetries: 1}); !errors.As(err, &jsonErr) {
+		t.Errorf("AskJSON of an invalid answer err = %v", err)
+	}
+	if len(chat.Request().Msgs()) != 1 {
+		t.Errorf("failed AskJSON changed the history: %+v", chat.Request().History())
+	}
+}
+
+func TestAskJSONScalar(t *testing.T) {
+	s := newStubServer(t, func(req *openai.ChatCompletionRequest) string { return "42" })
+	n, err := AskJSON[int](context.Background(), s.conversation(), "How many?", nil)
+	if err != nil || n != 42 {
+		t.Errorf("AskJSON[int] = %d, %v", n, err)
+	}
+	if reqs := s.chatRequests(); len(reqs) != 1 || reqs[0].ResponseFormat != nil {
+		t.Errorf("scalar requests = %+v", reqs)
+	}
+}
@@ -0,0 +1,42 @@
+package chatgpt
+
+import (
+	"errors"
+
+	"github.com/billikeu/go-chatgpt/common"
+	"github.com/billikeu/go-chatgpt/moderation"
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// error type and http status for metrics
+func classifyError(err error) (string, int) {
+	var apiErr *openai.APIError
+	if errors.As(err, &apiErr) {
+		return "api", apiErr.HTTPStatusCode
+	}
+	var reqErr *openai.RequestError
+	if errors.As(err, &reqErr) {
+		return "http", reqErr.HTTPStatusCode
+	}
+	if errors.Is(err, moderation.ErrBlocked) {
+		return "moderation", 0
+	}
+	return common.ClassifyError(err, "stream"), 0
+}
+
+// rough prompt token count of messages
+func estimateTokens(messages []openai.ChatCompletionMessage) int {
+	var tokens int
+	for _, v := range messages {
+		tokens += common.EstimateTokens(v.Content) + 4
+		for _, part := range v.MultiContent {
+			if part.Type == openai.ChatMessagePartTypeImageURL {
+				// a low detail image, high detail ones cost more
+				tokens += 85
+				continue
+			}
+			tokens += common.EstimateTokens(part.Text)
+		}
+	}
+	return tokens
+}
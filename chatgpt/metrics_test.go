@@ -0,0 +1,91 @@
+package chatgpt
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/billikeu/go-chatgpt/common"
+	openai "github.com/sashabaranov/go-openai"
+)
+
+var sampleReg = regexp.MustCompile(`^(\w+)(?:\{(.*)\})? \S+$`)
+
+// scrape metrics: the label sets of each sample name
+func scrape(t *testing.T, handler http.Handler) map[string][]string {
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Errorf("Content-Type = %q", ct)
+	}
+	samples := map[string][]string{}
+	for _, line := range strings.Split(strings.TrimSpace(rec.Body.String()), "\n") {
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+		m := sampleReg.FindStringSubmatch(line)
+		if m == nil {
+			t.Fatalf("invalid sample %q", line)
+		}
+		samples[m[1]] = append(samples[m[1]], m[2])
+	}
+	return samples
+}
+
+func TestPromMetrics(t *testing.T) {
+	s := newStubServer(t, func(req *openai.ChatCompletionRequest) string { return "hello there" })
+	chat := s.conversation()
+	metrics := common.NewPromMetrics()
+	chat.SetMetrics(metrics)
+
+	for i := 0; i < 3; i++ {
+		if err := chat.Ask(context.Background(), fmt.Sprintf("prompt number %d", i), nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	s.status = http.StatusInternalServerError
+	if err := chat.Ask(context.Background(), "failing prompt", nil); err == nil {
+		t.Fatal("Ask of a failing server succeeded")
+	}
+
+	samples := scrape(t, metrics)
+	want := map[string]int{ // series per sample name
+		"gochatgpt_first_token_seconds_count":      1,
+		"gochatgpt_request_duration_seconds_count": 2, // ok and error
+		"gochatgpt_answer_chunks_count":            1,
+		"gochatgpt_tokens_per_second_count":        1,
+		"gochatgpt_errors_total":                   1,
+	}
+	for name, n := range want {
+		if len(samples[name]) != n {
+			t.Errorf("%s has %d series %q, want %d", name, len(samples[name]), samples[name], n)
+		}
+	}
+	if labels := samples["gochatgpt_errors_total"]; len(labels) == 1 && !strings.Contains(labels[0], `status="500"`) {
+		t.Errorf("error labels = %s", labels[0])
+	}
+	if labels := samples["gochatgpt_request_duration_seconds_bucket"]; len(labels) == 0 || !strings.Contains(labels[0], `backend="chatgpt"`) {
+		t.Errorf("latency labels = %q", labels)
+	}
+	// labels are bounded: backend, result, error type and status, never prompts or ids
+	allowed := map[string]bool{"backend": true, "result": true, "type": true, "status": true, "method": true, "le": true}
+	for name, sets := range samples {
+		for _, set := range sets {
+			if strings.Contains(set, "prompt") {
+				t.Errorf("%s has a prompt label value: %s", name, set)
+			}
+			for _, pair := range strings.Split(set, ",") {
+				if pair == "" {
+					continue
+				}
+				if label := strings.SplitN(pair, "=", 2)[0]; !allowed[label] {
+					t.Errorf("%s has label %s", name, label)
+				}
+			}
+		}
+	}
+}
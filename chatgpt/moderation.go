@@ -0,0 +1,52 @@
+package chatgpt
+
+import (
+	"context"
+
+	"github.com/billikeu/go-chatgpt/moderation"
+	openai "github.com/sashabaranov/go-openai"
+)
+
+/*
+set moderation stage, nil: skip the stage.
+prompt runs before Ask sends the prompt, output runs on the answer text after every streamed chunk,
+so it should be cheap like moderation.RuleEngine.
+
+	rules := moderation.NewRuleEngine(moderation.Rule{Name: "secret", Keywords: []string{"project x"}, Action: moderation.ActionRedact})
+	chat.SetModeration(moderation.Chain(rules, moderation.NewOpenAIModerator(chat, moderation.ActionBlock)), rules)
+*/
+func (chat *ChatGPTConversion) SetModeration(prompt, output moderation.Moderator) {
+	chat.promptModerator = prompt
+	chat.outputModerator = output
+}
+
+// call the OpenAI moderation endpoint with the client settings of the conversation
+func (chat *ChatGPTConversion) Moderations(ctx context.Context, request openai.ModerationRequest) (openai.ModerationResponse, error) {
+	return chat.client.Moderations(ctx, request)
+}
+
+// check the prompt, return the prompt to send
+func (chat *ChatGPTConversion) moderatePrompt(ctx context.Context, state *answerState, prompt string) (string, error) {
+	if chat.promptModerator == nil {
+		return prompt, nil
+	}
+	res, err := moderation.Run(ctx, chat.promptModerator, moderation.StagePrompt, prompt)
+	state.record(res)
+	if err != nil {
+		return prompt, err
+	}
+	return res.Text, nil
+}
+
+// check the answer text, return the text to keep
+func (chat *ChatGPTConversion) moderateOutput(ctx context.Context, state *answerState, text string) (string, error) {
+	if chat.outputModerator == nil {
+		return text, nil
+	}
+	res, err := moderation.Run(ctx, chat.outputModerator, moderation.StageOutput, text)
+	state.record(res)
+	if err != nil {
+		return "", err
+	}
+	return res.Text, nil
+}
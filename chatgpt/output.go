@@ -0,0 +1,53 @@
+package chatgpt
+
+import (
+	"context"
+	"strings"
+
+	"github.com/billikeu/go-chatgpt/moderation"
+	"github.com/billikeu/go-chatgpt/params"
+)
+
+// moderation results and the answer text of an Ask
+type answerState struct {
+	results    []*params.ModerationResult
+	lastOutput string // categories of the last recorded output result
+	text       string // answer after output moderation, kept in history
+	shown      string // answer shown to the caller, PII restored
+	reset      bool   // the last chunk is the whole text, it replaces the chunks sent before
+}
+
+func (state *answerState) record(res *params.ModerationResult) {
+	if res == nil || !res.Flagged {
+		return
+	}
+	if res.Stage == moderation.StageOutput {
+		categories := strings.Join(res.Categories, ",")
+		if categories == state.lastOutput {
+			return
+		}
+		state.lastOutput = categories
+	}
+	state.results = append(state.results, res)
+}
+
+/*
+update the answer by the streamed text, return the new chunk for the caller.
+When output moderation rewrites text that was already sent, the chunk is the whole text and
+state.reset is set, the caller sends it with Answer.Reset so joined chunks match Answer.Text.
+*/
+func (chat *ChatGPTConversion) updateOutput(ctx context.Context, state *answerState, text string, done bool) (string, error) {
+	moderated, err := chat.moderateOutput(ctx, state, text)
+	if err != nil {
+		return "", err
+	}
+	state.text = moderated
+	shown := chat.restorePII(moderated, done)
+	state.reset = !strings.HasPrefix(shown, state.shown)
+	chunk := shown
+	if !state.reset {
+		chunk = shown[len(state.shown):]
+	}
+	state.shown = shown
+	return chunk, nil
+}
@@ -0,0 +1,69 @@
+package chatgpt
+
+import (
+	"context"
+	"testing"
+
+	"github.com/billikeu/go-chatgpt/moderation"
+	"github.com/billikeu/go-chatgpt/pii"
+)
+
+// join chunks the way a streaming consumer does
+func joinChunks(t *testing.T, chat *ChatGPTConversion, chunks []string) (string, *answerState, int) {
+	t.Helper()
+	state := &answerState{}
+	var text, joined string
+	resets := 0
+	for i, v := range chunks {
+		text += v
+		chunk, err := chat.updateOutput(context.Background(), state, text, i == len(chunks)-1)
+		if err != nil {
+			t.Fatalf("updateOutput: %v", err)
+		}
+		if state.reset {
+			resets++
+			joined = chunk
+		} else {
+			joined += chunk
+		}
+	}
+	return joined, state, resets
+}
+
+func TestUpdateOutput(t *testing.T) {
+	rules := moderation.NewRuleEngine(moderation.Rule{Name: "secret", Keywords: []string{"project x"}, Action: moderation.ActionRedact})
+	tests := []struct {
+		name       string
+		moderation moderation.Moderator
+		redactor   bool
+		chunks     []string
+		resets     int
+		want       string // "": not checked
+	}{
+		{"plain", nil, false, []string{"Hello", ", ", "world"}, 0, ""},
+		{"empty chunks", nil, false, []string{"", "a", "", "b"}, 0, ""},
+		{"redact inside one chunk", rules, false, []string{"about ", "project x", " today"}, 0, ""},
+		{"redact across chunks", rules, false, []string{"about project", " x today"}, 1, ""},
+		{"placeholder across chunks", nil, true, []string{"mail [EMA", "IL_1] now"}, 0, "mail bob@example.com now"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chat := NewChatGPTConversion("sk-test")
+			chat.SetModeration(nil, tt.moderation)
+			if tt.redactor {
+				chat.SetRedactor(pii.NewRedactor())
+				chat.redactPII("bob@example.com")
+			}
+			joined, state, resets := joinChunks(t, chat, tt.chunks)
+			if joined != state.shown {
+				t.Errorf("joined chunks %q, shown text %q", joined, state.shown)
+			}
+			if tt.want != "" && state.shown != tt.want {
+				t.Errorf("shown = %q, want %q", state.shown, tt.want)
+			}
+			if resets != tt.resets {
+				t.Errorf("resets = %d, want %d", resets, tt.resets)
+			}
+		})
+	}
+}
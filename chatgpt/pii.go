@@ -0,0 +1,37 @@
+package chatgpt
+
+import (
+	"github.com/billikeu/go-chatgpt/pii"
+)
+
+/*
+set PII redactor, nil: disable.
+Emails, phones, api keys and card numbers in prompts are replaced with placeholders before
+they are sent, the history keeps the placeholders, answers shown to the caller have them restored.
+
+	chat.SetRedactor(pii.NewRedactor())
+*/
+func (chat *ChatGPTConversion) SetRedactor(redactor *pii.Redactor) {
+	chat.redactor = redactor
+	if redactor != nil && chat.vault == nil {
+		chat.vault = pii.NewVault()
+	}
+}
+
+func (chat *ChatGPTConversion) redactPII(prompt string) string {
+	if chat.redactor == nil {
+		return prompt
+	}
+	return chat.redactor.Redact(chat.vault, prompt)
+}
+
+// done: the text is complete, otherwise an unfinished placeholder at the end is held back
+func (chat *ChatGPTConversion) restorePII(text string, done bool) string {
+	if chat.redactor == nil {
+		return text
+	}
+	if done {
+		return chat.vault.Restore(text)
+	}
+	return chat.vault.RestorePartial(text)
+}
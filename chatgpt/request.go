@@ -1,14 +1,24 @@
 package chatgpt
 
 import (
+	"fmt"
 	"sync"
 
+	"github.com/billikeu/go-chatgpt/common"
+
 	openai "github.com/sashabaranov/go-openai"
 )
 
 type Request struct {
 	chatMsg    []*ChatMsg
 	sysChatMsg ChatMsg
+
+	// rolling summary of chatMsg[:summarizedUpTo], the turns are kept for History
+	summary        string
+	summarizedUpTo int
+	summaryPolicy  SummaryPolicy
+
+	historyImages int // images of the last historyImages user messages are sent, 0: all
 	sync.RWMutex
 }
 
@@ -42,16 +52,176 @@ func (req *Request) PutUserMsg(content, name string) (string, string) {
 	return msg.id, parentId
 }
 
+// renturn msg_id, parent_id
+func (req *Request) PutUserParts(parts []ContentPart, name string) (string, string) {
+	req.Lock()
+	defer req.Unlock()
+	var parentId string
+	if len(req.chatMsg) > 0 {
+		parentId = req.chatMsg[len(req.chatMsg)-1].id
+	}
+	msg := NewChatMsgParts(openai.ChatMessageRoleUser, parts, name)
+	req.chatMsg = append(req.chatMsg, msg)
+	return msg.id, parentId
+}
+
+// images of the last n user messages are sent, older ones are replaced by a placeholder, 0: all
+func (req *Request) SetHistoryImages(n int) {
+	req.Lock()
+	defer req.Unlock()
+
+	req.historyImages = n
+}
+
+// remove the last message, nil: no messages
 func (req *Request) PopMsg() *ChatMsg {
 	req.Lock()
 	defer req.Unlock()
 
+	if len(req.chatMsg) == 0 {
+		return nil
+	}
 	msg := req.chatMsg[len(req.chatMsg)-1]
-	req.chatMsg = req.chatMsg[:len(req.chatMsg)-1]
+	req.remove(len(req.chatMsg) - 1)
 	return msg
+}
+
+// remove the message with id, false: not found
+func (req *Request) RemoveMsg(id string) bool {
+	req.Lock()
+	defer req.Unlock()
+
+	for i, v := range req.chatMsg {
+		if v.id == id {
+			req.remove(i)
+			return true
+		}
+	}
+	return false
+}
+
+func (req *Request) remove(i int) {
+	req.chatMsg = append(req.chatMsg[:i:i], req.chatMsg[i+1:]...)
+	if i < req.summarizedUpTo {
+		// the summary still covers the removed message
+		req.summarizedUpTo--
+	}
+}
+
+// transaction begin ++++++++++++++++++++++++++++++++++++++++++++++++++++
+
+/*
+Turn is a user message and its answer in flight. It is not part of the history until Commit,
+so a failed Ask leaves the history unchanged.
+
+	turn := req.Begin(chatgpt.NewChatMsg(openai.ChatMessageRoleUser, prompt, ""))
+	messages := req.Messages(turn)
+	// ... ask
+	req.CommitStream(turn, text, response)
+*/
+type Turn struct {
+	msg      *ChatMsg
+	parentId string
+	// uncommitted turns sent before msg, like the invalid answers of AskJSON
+	pending []*ChatMsg
+	// Commit only keeps the answer in msg, commitDeferred adds it to the history
+	deferred bool
+}
+
+func (turn *Turn) MsgId() string {
+	return turn.msg.id
+}
+
+func (turn *Turn) ParentId() string {
+	return turn.parentId
+}
+
+// start a turn with a user message, its parent is the last message
+func (req *Request) Begin(msg *ChatMsg) *Turn {
+	req.RLock()
+	defer req.RUnlock()
+
+	turn := &Turn{msg: msg}
+	if len(req.chatMsg) > 0 {
+		turn.parentId = req.chatMsg[len(req.chatMsg)-1].id
+	}
+	return turn
+}
+
+// messages to send for turn: the history and the message of turn
+func (req *Request) Messages(turn *Turn) []openai.ChatCompletionMessage {
+	req.RLock()
+	defer req.RUnlock()
+
+	chatMsg := append(req.chatMsg[:len(req.chatMsg):len(req.chatMsg)], turn.pending...)
+	chatMsg = append(chatMsg, turn.msg)
+	return req.messages(chatMsg, "")
+}
+
+// commit turn with a streamed answer to the history
+func (req *Request) CommitStream(turn *Turn, text string, responseStream *openai.ChatCompletionStreamResponse) {
+	turn.msg.resText = text
+	if responseStream != nil {
+		turn.msg.responseStream = responseStream
+		if len(responseStream.Choices) > 0 {
+			turn.msg.finishReason = string(responseStream.Choices[0].FinishReason)
+		}
+	}
+	req.commit(turn)
+}
+
+// commit turn with a non-streamed answer to the history
+func (req *Request) Commit(turn *Turn, text string, response *openai.ChatCompletionResponse) {
+	turn.msg.resText = text
+	if response != nil {
+		turn.msg.response = response
+		if len(response.Choices) > 0 {
+			turn.msg.finishReason = string(response.Choices[0].FinishReason)
+		}
+	}
+	req.commit(turn)
+}
 
+// commit turn with the candidates of a non-streamed answer with n > 1, candidates[index] is kept
+func (req *Request) CommitCandidates(turn *Turn, candidates []string, index int, response *openai.ChatCompletionResponse) {
+	turn.msg.candidates = candidates
+	req.Commit(turn, candidates[index], response)
 }
 
+// commit turn with the partial answer of a stopped Ask, it is marked as truncated
+func (req *Request) CommitTruncated(turn *Turn, text, finishReason string) {
+	turn.msg.resText = text
+	turn.msg.finishReason = finishReason
+	turn.msg.truncated = true
+	req.commit(turn)
+}
+
+// commit a deferred turn, it is kept with the prompt of the first pending turn
+func (req *Request) commitDeferred(turn *Turn) {
+	if len(turn.pending) > 0 {
+		turn.msg.request = turn.pending[0].request
+	}
+	turn.deferred = false
+	req.commit(turn)
+}
+
+func (req *Request) commit(turn *Turn) {
+	if turn.deferred {
+		return
+	}
+	req.Lock()
+	defer req.Unlock()
+
+	for _, v := range req.chatMsg {
+		if v == turn.msg {
+			return
+		}
+	}
+	req.chatMsg = append(req.chatMsg, turn.msg)
+}
+
+// transaction end ------------------------------------------------------
+
 func (req *Request) SetResStream(id string, text string, responseStream *openai.ChatCompletionStreamResponse) {
 	req.Lock()
 	defer req.Unlock()
@@ -80,6 +250,50 @@ func (req *Request) SetRes(id string, response *openai.ChatCompletionResponse) {
 	}
 }
 
+// set a non-streamed response and the answer text kept in the history, like the text of a selected choice
+func (req *Request) SetResText(id string, text string, response *openai.ChatCompletionResponse) {
+	if response == nil {
+		return
+	}
+	req.Lock()
+	defer req.Unlock()
+
+	for _, v := range req.chatMsg {
+		if v.id == id {
+			v.resText = text
+			v.response = response
+			return
+		}
+	}
+}
+
+// keep candidate index of the non-streamed answer of message id in the history
+func (req *Request) SelectChoice(id string, index int) error {
+	req.Lock()
+	defer req.Unlock()
+
+	for _, v := range req.chatMsg {
+		if v.id != id {
+			continue
+		}
+		// streamed, cached and truncated answers have a single answer
+		if v.response == nil || len(v.candidates) < 2 {
+			return fmt.Errorf("message %s has no candidates", id)
+		}
+		if index < 0 || index >= len(v.candidates) {
+			return fmt.Errorf("message %s has no choice %d", id, index)
+		}
+		v.resText = v.candidates[index]
+		for _, choice := range v.response.Choices {
+			if choice.Index == index {
+				v.finishReason = string(choice.FinishReason)
+			}
+		}
+		return nil
+	}
+	return fmt.Errorf("message %s not found", id)
+}
+
 // get message for send ask
 func (req *Request) GetMessage(options ...string) []openai.ChatCompletionMessage {
 	req.Lock()
@@ -88,10 +302,42 @@ func (req *Request) GetMessage(options ...string) []openai.ChatCompletionMessage
 	if len(options) > 0 {
 		parentId = options[0]
 	}
-	messages := []openai.ChatCompletionMessage{*req.sysChatMsg.request}
+	return req.messages(req.chatMsg, parentId)
+}
+
+// messages of turns to send, the caller holds the lock
+func (req *Request) messages(chatMsg []*ChatMsg, parentId string) []openai.ChatCompletionMessage {
+	messages := []openai.ChatCompletionMessage{}
+	if req.sysChatMsg.request != nil {
+		messages = append(messages, *req.sysChatMsg.request)
+	}
+	// summarized turns are replaced by the summary
+	turns := chatMsg
+	if req.summary != "" {
+		messages = append(messages, openai.ChatCompletionMessage{
+			Role:    openai.ChatMessageRoleSystem,
+			Content: summaryPrefix + req.summary,
+		})
+		turns = chatMsg[req.summarizedUpTo:]
+	}
+	// the first turn whose images are sent
+	imagesFrom := 0
+	if req.historyImages > 0 {
+		imagesFrom = len(turns)
+		for i, n := len(turns)-1, 0; i >= 0 && n < req.historyImages; i-- {
+			if hasImages(*turns[i].request) {
+				imagesFrom = i
+				n++
+			}
+		}
+	}
 	var done bool
-	for _, v := range req.chatMsg {
-		messages = append(messages, *v.request)
+	for i, v := range turns {
+		if i < imagesFrom && hasImages(*v.request) {
+			messages = append(messages, withoutImages(*v.request))
+		} else {
+			messages = append(messages, *v.request)
+		}
 		if !done && v.resText != "" {
 			messages = append(messages, openai.ChatCompletionMessage{
 				Role:    openai.ChatMessageRoleAssistant,
@@ -108,3 +354,114 @@ func (req *Request) GetMessage(options ...string) []openai.ChatCompletionMessage
 	}
 	return messages
 }
+
+// the committed messages
+func (req *Request) Msgs() []*ChatMsg {
+	req.RLock()
+	defer req.RUnlock()
+
+	return append([]*ChatMsg(nil), req.chatMsg...)
+}
+
+// the system message, nil: not set
+func (req *Request) SystemMsg() *ChatMsg {
+	req.RLock()
+	defer req.RUnlock()
+
+	if req.sysChatMsg.request == nil {
+		return nil
+	}
+	msg := req.sysChatMsg
+	return &msg
+}
+
+// all messages without the summary, for export
+func (req *Request) History() []openai.ChatCompletionMessage {
+	req.RLock()
+	defer req.RUnlock()
+
+	messages := []openai.ChatCompletionMessage{}
+	if req.sysChatMsg.request != nil {
+		messages = append(messages, *req.sysChatMsg.request)
+	}
+	return append(messages, turnMessages(req.chatMsg)...)
+}
+
+func turnMessages(turns []*ChatMsg) []openai.ChatCompletionMessage {
+	var messages []openai.ChatCompletionMessage
+	for _, v := range turns {
+		messages = append(messages, *v.request)
+		if v.resText != "" {
+			messages = append(messages, openai.ChatCompletionMessage{
+				Role:    openai.ChatMessageRoleAssistant,
+				Content: v.resText,
+			})
+		}
+	}
+	return messages
+}
+
+// summary begin ++++++++++++++++++++++++++++++++++++++++++++++++++++++++
+
+const summaryPrefix = "Summary of the earlier conversation:\n"
+
+// when and how the older turns of a Request are summarized
+type SummaryPolicy struct {
+	// summarize when the estimated tokens of the sent messages exceed it, 0: disabled
+	MaxTokens int
+	// recent turns (a prompt and its answer) always sent as they are, default 4
+	KeepTurns int
+}
+
+func (req *Request) SetSummaryPolicy(policy SummaryPolicy) {
+	req.Lock()
+	defer req.Unlock()
+
+	if policy.KeepTurns <= 0 {
+		policy.KeepTurns = 4
+	}
+	req.summaryPolicy = policy
+}
+
+// the summary and the count of turns it replaces
+func (req *Request) Summary() (string, int) {
+	req.RLock()
+	defer req.RUnlock()
+
+	return req.summary, req.summarizedUpTo
+}
+
+// turns to fold into the summary when the history exceeds the policy, upTo: turn count after summarizing
+func (req *Request) summaryCandidates() (summary string, turns []openai.ChatCompletionMessage, from, upTo int, ok bool) {
+	req.RLock()
+	defer req.RUnlock()
+
+	policy := req.summaryPolicy
+	if policy.MaxTokens <= 0 {
+		return "", nil, 0, 0, false
+	}
+	tokens := common.EstimateTokens(req.summary) + estimateTokens(turnMessages(req.chatMsg[req.summarizedUpTo:]))
+	if tokens <= policy.MaxTokens {
+		return "", nil, 0, 0, false
+	}
+	upTo = len(req.chatMsg) - policy.KeepTurns
+	if upTo <= req.summarizedUpTo {
+		return "", nil, 0, 0, false
+	}
+	return req.summary, turnMessages(req.chatMsg[req.summarizedUpTo:upTo]), req.summarizedUpTo, upTo, true
+}
+
+// replace turns [from, upTo) by summary, false when the summary changed meanwhile
+func (req *Request) commitSummary(summary string, from, upTo int) bool {
+	req.Lock()
+	defer req.Unlock()
+
+	if req.summarizedUpTo != from || upTo > len(req.chatMsg) {
+		return false
+	}
+	req.summary = summary
+	req.summarizedUpTo = upTo
+	return true
+}
+
+// summary end ----------------------------------------------------------
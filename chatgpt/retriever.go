@@ -0,0 +1,75 @@
+package chatgpt
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/billikeu/go-chatgpt/params"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// finds passages for a prompt, see rag.Store
+type Retriever interface {
+	Retrieve(ctx context.Context, query string, k int) ([]*params.Citation, error)
+}
+
+const defaultRetrievalPrompt = "Answer with the help of the following passages. Cite the passages you use as [n]. If they do not contain the answer, say so."
+
+/*
+set retriever, nil: disable.
+Every Ask retrieves the top k passages for the prompt and sends them as a system message before it,
+the message is not kept in the history. The passages are returned as Answer.Citations.
+
+	conversation.SetRetriever(store, 4)
+*/
+func (chat *ChatGPTConversion) SetRetriever(retriever Retriever, k int) {
+	if k <= 0 {
+		k = 4
+	}
+	chat.retriever = retriever
+	chat.retrieveK = k
+}
+
+// set the instruction before the passages
+func (chat *ChatGPTConversion) SetRetrievalPrompt(prompt string) {
+	chat.retrievalPrompt = prompt
+}
+
+// retrieve passages for prompt, errors are logged and the prompt is sent without context
+func (chat *ChatGPTConversion) retrieve(ctx context.Context, prompt string) []*params.Citation {
+	if chat.retriever == nil {
+		return nil
+	}
+	citations, err := chat.retriever.Retrieve(ctx, prompt, chat.retrieveK)
+	if err != nil {
+		chat.logger.Warn(ctx, "retrieve failed", "err", err)
+		return nil
+	}
+	return citations
+}
+
+// insert the passages before the last message
+func (chat *ChatGPTConversion) withContext(messages []openai.ChatCompletionMessage, citations []*params.Citation) []openai.ChatCompletionMessage {
+	if len(citations) == 0 || len(messages) == 0 {
+		return messages
+	}
+	instruction := chat.retrievalPrompt
+	if instruction == "" {
+		instruction = defaultRetrievalPrompt
+	}
+	var b strings.Builder
+	b.WriteString(instruction)
+	for _, v := range citations {
+		fmt.Fprintf(&b, "\n\n[%d] %s (%s)\n%s", v.Index, v.Title, v.Source, v.Text)
+	}
+	last := len(messages) - 1
+	out := make([]openai.ChatCompletionMessage, 0, len(messages)+1)
+	out = append(out, messages[:last]...)
+	out = append(out, openai.ChatCompletionMessage{
+		Role:    openai.ChatMessageRoleSystem,
+		Content: b.String(),
+	})
+	return append(out, messages[last])
+}
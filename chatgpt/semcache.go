@@ -0,0 +1,194 @@
+package chatgpt
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/billikeu/go-chatgpt/vector"
+	openai "github.com/sashabaranov/go-openai"
+	uuid "github.com/satori/go.uuid"
+)
+
+type semanticItem struct {
+	Namespace string      `json:"namespace"`
+	Prompt    string      `json:"prompt"`
+	Entry     *CacheEntry `json:"entry"`
+}
+
+type SemanticCacheStats struct {
+	Hits    uint64
+	Misses  uint64
+	HitRate float64
+	Entries int
+}
+
+/*
+SemanticCache answers paraphrased prompts: the last user prompt is embedded and
+a cached answer is replayed when its prompt has a cosine similarity >= threshold.
+Only requests with the same model, parameters and earlier messages are compared.
+
+	cache := chatgpt.NewSemanticCache(conversation, 0.95)
+	conversation.SetSemanticCache(cache)
+*/
+type SemanticCache struct {
+	embedder   Embedder
+	index      *vector.Index[*semanticItem]
+	threshold  float32
+	ttl        time.Duration
+	maxEntries int
+	order      []string // ids by insertion time
+	hits       uint64
+	misses     uint64
+	sync.Mutex
+}
+
+func NewSemanticCache(embedder Embedder, threshold float32) *SemanticCache {
+	return &SemanticCache{
+		embedder:   embedder,
+		index:      vector.NewIndex[*semanticItem](),
+		threshold:  threshold,
+		maxEntries: 10000,
+	}
+}
+
+// ttl <= 0: never expires
+func (c *SemanticCache) SetTTL(ttl time.Duration) {
+	c.ttl = ttl
+}
+
+// the oldest entries are evicted above maxEntries, default 10000
+func (c *SemanticCache) SetMaxEntries(maxEntries int) {
+	if maxEntries > 0 {
+		c.maxEntries = maxEntries
+	}
+}
+
+func (c *SemanticCache) Stats() SemanticCacheStats {
+	stats := SemanticCacheStats{
+		Hits:    atomic.LoadUint64(&c.hits),
+		Misses:  atomic.LoadUint64(&c.misses),
+		Entries: c.index.Len(),
+	}
+	if total := stats.Hits + stats.Misses; total > 0 {
+		stats.HitRate = float64(stats.Hits) / float64(total)
+	}
+	return stats
+}
+
+func (c *SemanticCache) embed(ctx context.Context, prompt string) ([]float32, error) {
+	vectors, err := c.embedder.Embed(ctx, []string{prompt})
+	if err != nil {
+		return nil, err
+	}
+	return vectors[0], nil
+}
+
+func (c *SemanticCache) lookup(namespace string, embedding []float32) (*CacheEntry, bool) {
+	now := time.Now()
+	var expired []string
+	matches := c.index.Search(embedding, 1, func(id string, item *semanticItem) bool {
+		if item.Entry.expired(now) {
+			expired = append(expired, id)
+			return false
+		}
+		return item.Namespace == namespace
+	})
+	for _, id := range expired {
+		c.index.Remove(id)
+	}
+	if len(matches) == 0 || matches[0].Score < c.threshold {
+		atomic.AddUint64(&c.misses, 1)
+		return nil, false
+	}
+	atomic.AddUint64(&c.hits, 1)
+	return matches[0].Payload.Entry, true
+}
+
+func (c *SemanticCache) store(namespace, prompt string, embedding []float32, entry *CacheEntry) {
+	c.Lock()
+	defer c.Unlock()
+
+	if c.ttl > 0 {
+		entry.ExpiresAt = time.Now().Add(c.ttl)
+	}
+	id := uuid.NewV4().String()
+	c.index.Add(id, embedding, &semanticItem{Namespace: namespace, Prompt: prompt, Entry: entry})
+	c.order = append(c.order, id)
+	for len(c.order) > c.maxEntries {
+		c.index.Remove(c.order[0])
+		c.order = c.order[1:]
+	}
+}
+
+// Lookup a cached answer for prompt, namespace separates unrelated requests
+func (c *SemanticCache) Lookup(ctx context.Context, namespace, prompt string) (*CacheEntry, error) {
+	embedding, err := c.embed(ctx, normalizePrompt(prompt))
+	if err != nil {
+		return nil, err
+	}
+	entry, _ := c.lookup(namespace, embedding)
+	return entry, nil
+}
+
+func (c *SemanticCache) Store(ctx context.Context, namespace, prompt string, entry *CacheEntry) error {
+	embedding, err := c.embed(ctx, normalizePrompt(prompt))
+	if err != nil {
+		return err
+	}
+	c.store(namespace, normalizePrompt(prompt), embedding, entry)
+	return nil
+}
+
+// semantic key of a request: the earlier messages and the embedded last user prompt
+type semanticKey struct {
+	namespace string
+	prompt    string
+	embedding []float32
+}
+
+/*
+set semantic cache, nil: disable.
+It is checked after the exact cache of SetCache misses.
+*/
+func (chat *ChatGPTConversion) SetSemanticCache(cache *SemanticCache) {
+	chat.semanticCache = cache
+}
+
+// opt this conversation out of the semantic cache, the cache can still be shared by others
+func (chat *ChatGPTConversion) SetSemanticCacheEnabled(enabled bool) {
+	chat.semanticOff = !enabled
+}
+
+func (chat *ChatGPTConversion) semanticGet(ctx context.Context, req openai.ChatCompletionRequest) (*CacheEntry, *semanticKey, bool) {
+	if chat.semanticCache == nil || chat.semanticOff || len(req.Messages) == 0 {
+		return nil, nil, false
+	}
+	last := req.Messages[len(req.Messages)-1]
+	if last.Role != openai.ChatMessageRoleUser || len(last.MultiContent) > 0 {
+		return nil, nil, false
+	}
+	earlier := req
+	earlier.Messages = req.Messages[:len(req.Messages)-1]
+	key := &semanticKey{
+		namespace: CacheKey(earlier),
+		prompt:    normalizePrompt(last.Content),
+	}
+	embedding, err := chat.semanticCache.embed(ctx, key.prompt)
+	if err != nil {
+		chat.logger.Warn(ctx, "semantic cache embed failed", "err", err)
+		return nil, nil, false
+	}
+	key.embedding = embedding
+	entry, ok := chat.semanticCache.lookup(key.namespace, embedding)
+	return entry, key, ok
+}
+
+func (chat *ChatGPTConversion) semanticSet(key *semanticKey, entry *CacheEntry) {
+	if chat.semanticCache == nil || key == nil {
+		return
+	}
+	copied := *entry
+	chat.semanticCache.store(key.namespace, key.prompt, key.embedding, &copied)
+}
@@ -0,0 +1,155 @@
+package chatgpt
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/billikeu/go-chatgpt/common"
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// a stub of the OpenAI API for tests
+type stubServer struct {
+	*httptest.Server
+	// the answer of a chat request, choice i > 0 gets " (i)" appended
+	reply func(req *openai.ChatCompletionRequest) string
+	// run before a chat request is answered, like waiting for a test
+	before func(r *http.Request)
+	// answer chat requests with this http status, 0: answer
+	status int
+	// stream this many chunks, then wait until the client goes away, 0: no stall
+	stallAfter int
+
+	sync.Mutex
+	chats      []*openai.ChatCompletionRequest
+	embeddings [][]string // inputs of each embeddings request
+}
+
+func newStubServer(t *testing.T, reply func(req *openai.ChatCompletionRequest) string) *stubServer {
+	s := &stubServer{reply: reply}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.handle))
+	t.Cleanup(s.Close)
+	return s
+}
+
+// an initialized conversation talking to the stub, without logs
+func (s *stubServer) conversation() *ChatGPTConversion {
+	chat := NewChatGPTConversion("sk-test")
+	chat.SetBaseURL(s.URL + "/v1")
+	chat.SetLogger(common.NopLogger{})
+	chat.Init()
+	return chat
+}
+
+func (s *stubServer) chatRequests() []*openai.ChatCompletionRequest {
+	s.Lock()
+	defer s.Unlock()
+
+	return append([]*openai.ChatCompletionRequest(nil), s.chats...)
+}
+
+func (s *stubServer) handle(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if strings.HasSuffix(r.URL.Path, "/embeddings") {
+		s.embed(w, r)
+		return
+	}
+	req := &openai.ChatCompletionRequest{}
+	if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	s.Lock()
+	s.chats = append(s.chats, req)
+	s.Unlock()
+	if s.before != nil {
+		s.before(r)
+	}
+	if s.status != 0 {
+		w.WriteHeader(s.status)
+		fmt.Fprintf(w, `{"error":{"message":"stub error","type":"server_error"}}`)
+		return
+	}
+	n := req.N
+	if n < 1 {
+		n = 1
+	}
+	texts := make([]string, n)
+	for i := range texts {
+		texts[i] = s.reply(req)
+		if i > 0 {
+			texts[i] += fmt.Sprintf(" (%d)", i)
+		}
+	}
+	usage := openai.Usage{PromptTokens: 10, CompletionTokens: 5, TotalTokens: 15}
+	if !req.Stream {
+		resp := openai.ChatCompletionResponse{ID: "chatcmpl-1", Object: "chat.completion", Model: req.Model + "-0613", Usage: usage}
+		for i, text := range texts {
+			resp.Choices = append(resp.Choices, openai.ChatCompletionChoice{
+				Index:        i,
+				Message:      openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, Content: text},
+				FinishReason: openai.FinishReasonStop,
+			})
+		}
+		json.NewEncoder(w).Encode(resp)
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	flusher := w.(http.Flusher)
+	send := func(resp openai.ChatCompletionStreamResponse) {
+		resp.ID, resp.Object, resp.Model = "chatcmpl-1", "chat.completion.chunk", req.Model+"-0613"
+		b, _ := json.Marshal(resp)
+		fmt.Fprintf(w, "data: %s\n\n", b)
+		flusher.Flush()
+	}
+	for i, word := range strings.SplitAfter(texts[0], " ") {
+		if s.stallAfter > 0 && i == s.stallAfter {
+			<-r.Context().Done()
+			return
+		}
+		send(openai.ChatCompletionStreamResponse{Choices: []openai.ChatCompletionStreamChoice{
+			{Delta: openai.ChatCompletionStreamChoiceDelta{Content: word}},
+		}})
+	}
+	send(openai.ChatCompletionStreamResponse{Choices: []openai.ChatCompletionStreamChoice{
+		{FinishReason: openai.FinishReasonStop},
+	}})
+	if req.StreamOptions != nil && req.StreamOptions.IncludeUsage {
+		send(openai.ChatCompletionStreamResponse{Choices: []openai.ChatCompletionStreamChoice{}, Usage: &usage})
+	}
+	fmt.Fprintf(w, "data: [DONE]\n\n")
+}
+
+// every input gets the vector {len(input), 1}, the data is sent in reverse order
+func (s *stubServer) embed(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Input []string `json:"input"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	s.Lock()
+	s.embeddings = append(s.embeddings, req.Input)
+	s.Unlock()
+	resp := openai.EmbeddingResponse{Object: "list", Model: openai.AdaEmbeddingV2}
+	for i := len(req.Input) - 1; i >= 0; i-- {
+		resp.Data = append(resp.Data, openai.Embedding{Object: "embedding", Index: i, Embedding: []float32{float32(len(req.Input[i])), 1}})
+	}
+	json.NewEncoder(w).Encode(resp)
+}
+
+// the last user message of a chat request
+func lastUserContent(req *openai.ChatCompletionRequest) string {
+	for i := len(req.Messages) - 1; i >= 0; i-- {
+		if req.Messages[i].Role == openai.ChatMessageRoleUser {
+			return req.Messages[i].Content
+		}
+	}
+	return ""
+}
@@ -0,0 +1,48 @@
+package chatgpt
+
+import (
+	"context"
+	"sync/atomic"
+)
+
+// the running Ask, canceled by Stop
+type askRun struct {
+	cancel  context.CancelFunc
+	stopped atomic.Bool
+}
+
+/*
+stop the running Ask: the stream is canceled, the partial answer is kept in the history
+marked as truncated, and the last callback gets Done with FinishReason params.FinishReasonStopped.
+false: no Ask is running.
+*/
+func (chat *ChatGPTConversion) Stop() bool {
+	chat.runMu.Lock()
+	defer chat.runMu.Unlock()
+
+	if chat.run == nil {
+		return false
+	}
+	chat.run.stopped.Store(true)
+	chat.run.cancel()
+	return true
+}
+
+// register a cancelable Ask, the returned ctx is canceled by Stop
+func (chat *ChatGPTConversion) startRun(ctx context.Context) (context.Context, *askRun) {
+	ctx, cancel := context.WithCancel(ctx)
+	run := &askRun{cancel: cancel}
+	chat.runMu.Lock()
+	chat.run = run
+	chat.runMu.Unlock()
+	return ctx, run
+}
+
+func (chat *ChatGPTConversion) endRun(run *askRun) {
+	chat.runMu.Lock()
+	if chat.run == run {
+		chat.run = nil
+	}
+	chat.runMu.Unlock()
+	run.cancel()
+}
@@ -0,0 +1,59 @@
+package chatgpt
+
+import (
+	"context"
+	"testing"
+
+	"github.com/billikeu/go-chatgpt/params"
+	openai "github.com/sashabaranov/go-openai"
+)
+
+func TestStop(t *testing.T) {
+	s := newStubServer(t, func(req *openai.ChatCompletionRequest) string { return "a long answer" })
+	s.stallAfter = 1
+	chat := s.conversation()
+
+	var last *params.Answer
+	var stopped bool
+	err := chat.Ask(context.Background(), "hi", func(answer *params.Answer, err error) {
+		if err != nil {
+			t.Errorf("callback err = %v", err)
+			return
+		}
+		last = answer
+		if !answer.Done && !stopped {
+			stopped = chat.Stop()
+		}
+	})
+	if err != nil || !stopped {
+		t.Fatalf("Ask = %v, stopped %v", err, stopped)
+	}
+	if !last.Done || last.FinishReason != params.FinishReasonStopped || last.Text != "a " {
+		t.Errorf("last answer = %+v", last)
+	}
+	// the partial answer is kept as truncated
+	msgs := chat.Request().Msgs()
+	if len(msgs) != 1 || msgs[0].Answer() != "a " || !msgs[0].Truncated() || msgs[0].FinishReason() != params.FinishReasonStopped {
+		t.Errorf("history = %+v", chat.Request().History())
+	}
+}
+
+func TestStopWithoutAsk(t *testing.T) {
+	s := newStubServer(t, func(req *openai.ChatCompletionRequest) string { return "hello there" })
+	chat := s.conversation()
+	if chat.Stop() {
+		t.Errorf("Stop without an Ask returned true")
+	}
+	if len(chat.Request().Msgs()) != 0 {
+		t.Errorf("Stop changed the history")
+	}
+	// the next Ask is not stopped
+	var last *params.Answer
+	if err := chat.Ask(context.Background(), "hi", func(answer *params.Answer, err error) { last = answer }); err != nil {
+		t.Fatal(err)
+	}
+	msgs := chat.Request().Msgs()
+	if last.FinishReason != "stop" || len(msgs) != 1 || msgs[0].Truncated() || msgs[0].Answer() != "hello there" {
+		t.Errorf("answer after Stop = %+v", last)
+	}
+}
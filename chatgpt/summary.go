@@ -0,0 +1,94 @@
+package chatgpt
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/billikeu/go-chatgpt/common"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+const defaultSummaryPrompt = "Summarize the conversation below for your own memory. Keep names, numbers, decisions and open questions. Write at most 200 words."
+
+/*
+enable the rolling summary: when the history exceeds policy.MaxTokens,
+turns older than policy.KeepTurns are summarized by a side call before the next Ask.
+The summary replaces them in requests, History still returns all turns.
+
+	conversation.SetSummaryPolicy(chatgpt.SummaryPolicy{MaxTokens: 2000, KeepTurns: 4})
+*/
+func (chat *ChatGPTConversion) SetSummaryPolicy(policy SummaryPolicy) {
+	chat.requst.SetSummaryPolicy(policy)
+}
+
+// set the summarizer model, default the conversation model
+func (chat *ChatGPTConversion) SetSummaryModel(model string) {
+	chat.summaryModel = model
+}
+
+// set the summarizer instruction
+func (chat *ChatGPTConversion) SetSummaryPrompt(prompt string) {
+	chat.summaryPrompt = prompt
+}
+
+// all messages of the conversation including summarized turns
+func (chat *ChatGPTConversion) History() []openai.ChatCompletionMessage {
+	return chat.requst.History()
+}
+
+// summarize old turns when needed, errors are logged and the full history is sent
+func (chat *ChatGPTConversion) summarize(ctx context.Context) {
+	summary, turns, from, upTo, ok := chat.requst.summaryCandidates()
+	if !ok {
+		return
+	}
+	ctx, span := chat.tracer.Start(ctx, "chatgpt.summarize", common.Attribute(common.AttrBackend, common.BackendChatGPT))
+	summary, err := chat.newSummary(ctx, summary, turns)
+	common.EndSpan(span, err)
+	if err != nil {
+		chat.logger.Warn(ctx, "summarize failed", "err", err)
+		return
+	}
+	if !chat.requst.commitSummary(summary, from, upTo) {
+		chat.logger.Debug(ctx, "summary discarded, history changed")
+		return
+	}
+	chat.logger.Debug(ctx, "history summarized", "turns", upTo)
+}
+
+// fold turns into the previous summary
+func (chat *ChatGPTConversion) newSummary(ctx context.Context, previous string, turns []openai.ChatCompletionMessage) (string, error) {
+	instruction := chat.summaryPrompt
+	if instruction == "" {
+		instruction = defaultSummaryPrompt
+	}
+	var b strings.Builder
+	if previous != "" {
+		fmt.Fprintf(&b, "Earlier summary:\n%s\n\n", previous)
+	}
+	for _, v := range turns {
+		fmt.Fprintf(&b, "%s: %s\n\n", v.Role, messageText(v))
+	}
+	model := chat.summaryModel
+	if model == "" {
+		model = chat.model
+	}
+	resp, err := chat.client.CreateChatCompletion(ctx, openai.ChatCompletionRequest{
+		Model:     model,
+		MaxTokens: chat.maxTokens,
+		Messages: []openai.ChatCompletionMessage{
+			{Role: openai.ChatMessageRoleSystem, Content: instruction},
+			{Role: openai.ChatMessageRoleUser, Content: b.String()},
+		},
+	})
+	if err != nil {
+		return "", err
+	}
+	if len(resp.Choices) == 0 || strings.TrimSpace(resp.Choices[0].Message.Content) == "" {
+		return "", errors.New("empty summary")
+	}
+	return strings.TrimSpace(resp.Choices[0].Message.Content), nil
+}
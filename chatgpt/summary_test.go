@@ -0,0 +1,116 @@
+package chatgpt
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// a request with n committed turns of 8 estimated tokens per prompt and answer
+func requestWithTurns(n int) *Request {
+	req := NewRequest()
+	for i := 0; i < n; i++ {
+		turn := req.Begin(NewChatMsg(openai.ChatMessageRoleUser, strings.Repeat("q", 32), ""))
+		req.CommitStream(turn, strings.Repeat("a", 32), nil)
+	}
+	return req
+}
+
+func TestSummaryCandidates(t *testing.T) {
+	tests := []struct {
+		name     string
+		turns    int
+		policy   SummaryPolicy
+		ok       bool
+		from     int
+		upTo     int
+		messages int
+	}{
+		{"disabled", 6, SummaryPolicy{}, false, 0, 0, 0},
+		{"below the limit", 6, SummaryPolicy{MaxTokens: 1000, KeepTurns: 2}, false, 0, 0, 0},
+		{"keep 2 turns", 6, SummaryPolicy{MaxTokens: 50, KeepTurns: 2}, true, 0, 4, 8},
+		{"default keeps 4 turns", 6, SummaryPolicy{MaxTokens: 50}, true, 0, 2, 4},
+		{"only kept turns", 3, SummaryPolicy{MaxTokens: 10, KeepTurns: 4}, false, 0, 0, 0},
+	}
+	for _, tt := range tests {
+		req := requestWithTurns(tt.turns)
+		req.SetSummaryPolicy(tt.policy)
+		summary, turns, from, upTo, ok := req.summaryCandidates()
+		if ok != tt.ok || from != tt.from || upTo != tt.upTo || len(turns) != tt.messages || summary != "" {
+			t.Errorf("%s: summaryCandidates = %q, %d messages, %d, %d, %v", tt.name, summary, len(turns), from, upTo, ok)
+		}
+	}
+}
+
+func TestCommitSummary(t *testing.T) {
+	req := requestWithTurns(6)
+	req.SetSummaryPolicy(SummaryPolicy{MaxTokens: 50, KeepTurns: 2})
+	_, _, from, upTo, _ := req.summaryCandidates()
+
+	// a summary committed meanwhile wins, the later one is discarded
+	if !req.commitSummary("first", from, upTo) {
+		t.Fatal("commitSummary failed")
+	}
+	if req.commitSummary("second", from, upTo) {
+		t.Errorf("commitSummary of a changed summary succeeded")
+	}
+	if summary, n := req.Summary(); summary != "first" || n != 4 {
+		t.Errorf("Summary = %q, %d", summary, n)
+	}
+	// the summary replaces the first 4 turns in requests, History keeps them
+	messages := req.GetMessage()
+	if len(messages) != 5 || messages[0].Content != summaryPrefix+"first" {
+		t.Errorf("messages = %+v", messages)
+	}
+	if len(req.History()) != 12 {
+		t.Errorf("History has %d messages", len(req.History()))
+	}
+
+	// the next summary starts after the first one
+	for i := 0; i < 2; i++ {
+		turn := req.Begin(NewChatMsg(openai.ChatMessageRoleUser, strings.Repeat("q", 32), ""))
+		req.CommitStream(turn, strings.Repeat("a", 32), nil)
+	}
+	summary, turns, from, upTo, ok := req.summaryCandidates()
+	if !ok || summary != "first" || from != 4 || upTo != 6 || len(turns) != 4 {
+		t.Errorf("next summaryCandidates = %q, %d messages, %d, %d, %v", summary, len(turns), from, upTo, ok)
+	}
+	// removed turns make the candidates stale
+	req.PopMsg()
+	req.PopMsg()
+	req.PopMsg()
+	if req.commitSummary("stale", from, upTo) {
+		t.Errorf("commitSummary beyond the history succeeded")
+	}
+}
+
+func TestSummarizeConcurrentChange(t *testing.T) {
+	s := newStubServer(t, func(req *openai.ChatCompletionRequest) string {
+		if req.Messages[0].Content == defaultSummaryPrompt {
+			return "slow summary"
+		}
+		return "answer"
+	})
+	chat := s.conversation()
+	chat.SetRequest(requestWithTurns(6))
+	chat.SetSummaryPolicy(SummaryPolicy{MaxTokens: 50, KeepTurns: 2})
+	// another summary is committed while the summary call runs
+	s.before = func(r *http.Request) {
+		if len(s.chatRequests()) == 1 {
+			chat.Request().commitSummary("other summary", 0, 3)
+		}
+	}
+	if err := chat.Ask(context.Background(), "hi", nil); err != nil {
+		t.Fatal(err)
+	}
+	if summary, n := chat.Request().Summary(); summary != "other summary" || n != 3 {
+		t.Errorf("Summary = %q, %d", summary, n)
+	}
+	reqs := s.chatRequests()
+	if len(reqs) != 2 || reqs[1].Messages[0].Content != summaryPrefix+"other summary" {
+		t.Errorf("requests = %+v", reqs)
+	}
+}
@@ -0,0 +1,109 @@
+package chatgpt
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"testing"
+
+	"github.com/billikeu/go-chatgpt/common"
+	"github.com/billikeu/go-chatgpt/params"
+	openai "github.com/sashabaranov/go-openai"
+)
+
+type spanKey struct{}
+
+// a tracer keeping every span
+type recordingTracer struct {
+	sync.Mutex
+	spans []*recordedSpan
+}
+
+type recordedSpan struct {
+	name   string
+	parent string
+	attrs  map[string]interface{}
+	err    error
+	ended  bool
+}
+
+func (tr *recordingTracer) Start(ctx context.Context, name string, attrs ...common.Attr) (context.Context, common.Span) {
+	span := &recordedSpan{name: name, attrs: map[string]interface{}{}}
+	if parent, ok := ctx.Value(spanKey{}).(*recordedSpan); ok {
+		span.parent = parent.name
+	}
+	span.SetAttributes(attrs...)
+	tr.Lock()
+	tr.spans = append(tr.spans, span)
+	tr.Unlock()
+	return context.WithValue(ctx, spanKey{}, span), span
+}
+
+func (span *recordedSpan) SetAttributes(attrs ...common.Attr) {
+	for _, v := range attrs {
+		span.attrs[v.Key] = v.Value
+	}
+}
+
+func (span *recordedSpan) RecordError(err error) {
+	span.err = err
+}
+
+func (span *recordedSpan) End() {
+	span.ended = true
+}
+
+func TestTracing(t *testing.T) {
+	s := newStubServer(t, func(req *openai.ChatCompletionRequest) string { return `{"city":"Paris","unit":"celsius","temp":21}` })
+	chat := s.conversation()
+	tracer := &recordingTracer{}
+	chat.SetTracer(tracer)
+
+	var msgId string
+	if err := chat.Ask(context.Background(), "hi", func(answer *params.Answer, err error) {
+		if answer != nil {
+			msgId = answer.MsgId
+		}
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if len(tracer.spans) != 1 {
+		t.Fatalf("%d spans", len(tracer.spans))
+	}
+	span := tracer.spans[0]
+	want := map[string]interface{}{
+		common.AttrBackend:      common.BackendChatGPT,
+		common.AttrModel:        openai.GPT3Dot5Turbo,
+		common.AttrMessageId:    msgId,
+		common.AttrParentId:     "",
+		common.AttrRetryCount:   0,
+		common.AttrFinishReason: "stop",
+		common.AttrStatus:       "ok",
+	}
+	for key, value := range want {
+		if span.attrs[key] != value {
+			t.Errorf("attribute %s = %v, want %v", key, span.attrs[key], value)
+		}
+	}
+	if span.name != "chatgpt.Ask" || !span.ended || span.err != nil || span.attrs[common.AttrChunks].(int) == 0 || span.attrs[common.AttrPromptTokens].(int) == 0 {
+		t.Errorf("span = %+v", span)
+	}
+
+	// a failed Ask ends its span with the error
+	s.status = http.StatusInternalServerError
+	err := chat.Ask(context.Background(), "hi", nil)
+	span = tracer.spans[1]
+	if err == nil || !span.ended || span.err == nil || span.attrs[common.AttrStatus] != "error" {
+		t.Errorf("span of a failed Ask = %+v, Ask err %v", span, err)
+	}
+
+	// the Ask of AskJSON is a child span
+	s.status = 0
+	tracer.spans = nil
+	if _, err := AskJSON[testWeather](context.Background(), chat, "Weather?", nil); err != nil {
+		t.Fatal(err)
+	}
+	if len(tracer.spans) != 2 || tracer.spans[0].name != "chatgpt.AskJSON" || tracer.spans[1].parent != "chatgpt.AskJSON" || !tracer.spans[0].ended {
+		t.Errorf("spans of AskJSON = %+v", tracer.spans)
+	}
+}
@@ -0,0 +1,92 @@
+package chatgpt
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/billikeu/go-chatgpt/common"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+/*
+httpSettings builds the http client of a config: the injected client or transport, with the
+proxy or proxy pool and the extra headers composed on top of it.
+*/
+type httpSettings struct {
+	client    *http.Client      // nil: a plain client
+	transport http.RoundTripper // nil: the transport of client or http.DefaultTransport
+	proxy     string
+	proxyPool *common.ProxyPool
+	headers   http.Header
+}
+
+// set config.HTTPClient from the settings
+func (s *httpSettings) apply(config *openai.ClientConfig) error {
+	client := &http.Client{}
+	if s.client != nil {
+		c := *s.client
+		client = &c
+	}
+	transport := s.transport
+	if transport == nil {
+		transport = client.Transport
+	}
+	if s.proxy != "" || s.proxyPool != nil {
+		base, err := baseTransport(transport)
+		if err != nil {
+			return err
+		}
+		if s.proxyPool != nil {
+			transport = s.proxyPool.Transport(base)
+		} else {
+			base = base.Clone()
+			if err := common.ApplyProxy(base, s.proxy); err != nil {
+				return fmt.Errorf("set proxy err:%s", err.Error())
+			}
+			transport = base
+		}
+	}
+	if len(s.headers) > 0 {
+		if transport == nil {
+			transport = http.DefaultTransport
+		}
+		transport = &headerTransport{base: transport, headers: s.headers.Clone()}
+	}
+	client.Transport = transport
+	config.HTTPClient = client
+	return nil
+}
+
+// proxies are set on an *http.Transport, other round trippers cannot be composed with a proxy
+func baseTransport(transport http.RoundTripper) (*http.Transport, error) {
+	if transport == nil {
+		return http.DefaultTransport.(*http.Transport), nil
+	}
+	base, ok := transport.(*http.Transport)
+	if !ok {
+		return nil, errors.New("a proxy needs an *http.Transport, set the proxy on the custom transport instead")
+	}
+	return base, nil
+}
+
+// sets extra headers on every request
+type headerTransport struct {
+	base    http.RoundTripper
+	headers http.Header
+}
+
+func (t *headerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	for k, v := range t.headers {
+		req.Header[k] = v
+	}
+	return t.base.RoundTrip(req)
+}
+
+func (t *headerTransport) CloseIdleConnections() {
+	if v, ok := t.base.(interface{ CloseIdleConnections() }); ok {
+		v.CloseIdleConnections()
+	}
+}
@@ -0,0 +1,79 @@
+package chatgpt
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// settings changed after Init reach the next request
+func TestHTTPSettingsAfterInit(t *testing.T) {
+	headers := make(chan http.Header, 4)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		headers <- r.Header.Clone()
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"object":"list","data":[]}`)
+	}))
+	defer server.Close()
+
+	chat := NewChatGPTConversion("sk-test")
+	chat.SetBaseURL(server.URL + "/v1")
+	if err := chat.Init(); err != nil {
+		t.Fatal(err)
+	}
+	if err := chat.Ping(context.Background()); err != nil {
+		t.Fatalf("Ping: %v", err)
+	}
+	if got := (<-headers).Get("OpenAI-Organization"); got != "" {
+		t.Errorf("organization before SetOrganization = %q", got)
+	}
+
+	if err := chat.SetOrganization("org-1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := chat.SetHeader("X-Request-Source", "bot"); err != nil {
+		t.Fatal(err)
+	}
+	if err := chat.Ping(context.Background()); err != nil {
+		t.Fatalf("Ping: %v", err)
+	}
+	h := <-headers
+	if h.Get("OpenAI-Organization") != "org-1" || h.Get("X-Request-Source") != "bot" {
+		t.Errorf("headers after Init = %v", h)
+	}
+
+	if err := chat.SetHeader("X-Request-Source", ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := chat.RefreshSecretKey("sk-other"); err != nil {
+		t.Fatal(err)
+	}
+	if err := chat.Ping(context.Background()); err != nil {
+		t.Fatalf("Ping: %v", err)
+	}
+	h = <-headers
+	if h.Get("OpenAI-Organization") != "org-1" || h.Get("X-Request-Source") != "" || h.Get("Authorization") != "Bearer sk-other" {
+		t.Errorf("headers after RefreshSecretKey = %v", h)
+	}
+}
+
+func TestHTTPSettingsProxyNeedsTransport(t *testing.T) {
+	chat := NewChatGPTConversion("sk-test")
+	if err := chat.SetTransport(roundTripFunc(http.DefaultTransport.RoundTrip)); err != nil {
+		t.Fatal(err)
+	}
+	if err := chat.SetProxy("http://127.0.0.1:3128"); err == nil {
+		t.Errorf("a proxy was composed with a custom round tripper")
+	}
+	if err := chat.SetProxy("ftp://127.0.0.1"); err == nil {
+		t.Errorf("an invalid proxy was accepted")
+	}
+}
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
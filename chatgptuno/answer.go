@@ -0,0 +1,99 @@
+package chatgptuno
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/billikeu/go-chatgpt/common"
+	"github.com/billikeu/go-chatgpt/params"
+)
+
+/*
+AskAnswer is AskContext with the callback of the chatgpt backend: chunks are diffs of the
+answer text and a final answer with Done, FinishReason and estimated Usage is sent at the end.
+When the backend rewrites text that was already sent, the chunk is the whole text with Reset set.
+ParentId is the parent the prompt was sent with, resolved from the conversation when parentId is "".
+
+	err := bot.AskAnswer(ctx, "hello", "", "", "", 60, func(answer *params.Answer, err error) {
+		if answer != nil && answer.Done {
+			log.Println(answer.Model, answer.FinishReason, answer.Usage.TotalTokens)
+		}
+	})
+*/
+func (chat *ChatGPTUnoBot) AskAnswer(ctx context.Context, prompt, conversationId, parentId, model string, timeout int, callback func(answer *params.Answer, err error)) error {
+	start := time.Now()
+	var firstToken time.Duration
+	var text, msgId, slug, finishType string
+	var chunkIndex int
+	var reset bool
+	slug = chat.getModelName(model)
+	newAnswer := func(chunk string, done bool) *params.Answer {
+		answer := params.NewAnswer(msgId, parentId, chunk, text, done, chunkIndex)
+		answer.Reset = reset && !done
+		answer.Role = "assistant"
+		answer.Model = slug
+		answer.Backend = common.BackendChatGPTUno
+		answer.ConversationId = conversationId
+		answer.Elapsed = time.Since(start)
+		answer.FirstToken = firstToken
+		if firstToken == 0 {
+			answer.FirstToken = answer.Elapsed
+		}
+		if done {
+			answer.FinishReason = FinishDetail{Type: finishType}.Reason()
+			answer.Usage = params.EstimatedUsage(common.EstimateTokens(prompt), common.EstimateTokens(text))
+		}
+		return answer
+	}
+	resolved := func(id string) {
+		parentId = id
+	}
+	err := chat.askContext(ctx, prompt, conversationId, parentId, model, timeout, resolved, func(res *Response, err error) {
+		if err != nil {
+			if callback != nil {
+				callback(nil, err)
+			}
+			return
+		}
+		if res.ConversationID != "" {
+			conversationId = res.ConversationID
+		}
+		if res.Message.Author.Role != "assistant" || len(res.Message.Content.Parts) == 0 {
+			return
+		}
+		if firstToken == 0 {
+			firstToken = time.Since(start)
+		}
+		if res.Message.Metadata.ModelSlug != "" {
+			slug = res.Message.Metadata.ModelSlug
+		}
+		if res.Message.Metadata.FinishDetails.Type != "" {
+			finishType = res.Message.Metadata.FinishDetails.Type
+		}
+		msgId = res.Message.ID
+		full := strings.Join(res.Message.Content.Parts, "")
+		// the backend sends the whole text every time, usually extending the last one
+		reset = !strings.HasPrefix(full, text)
+		chunk := full
+		if !reset {
+			chunk = full[len(text):]
+		}
+		text = full
+		if chunk == "" && !reset {
+			return
+		}
+		chunkIndex++
+		if callback != nil {
+			callback(newAnswer(chunk, false), nil)
+		}
+	})
+	if err != nil {
+		return err
+	}
+	if callback != nil {
+		chunkIndex++
+		callback(newAnswer("", true), nil)
+	}
+	return nil
+}
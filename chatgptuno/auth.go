@@ -2,6 +2,7 @@ package chatgptuno
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"io"
@@ -11,6 +12,7 @@ import (
 	"regexp"
 	"strings"
 
+	"github.com/billikeu/go-chatgpt/common"
 	http "github.com/bogdanfinn/fhttp"
 	tls_client "github.com/bogdanfinn/tls-client"
 	"github.com/tidwall/gjson"
@@ -22,6 +24,12 @@ type AuthConfig struct {
 	EmailAddr string
 	Passwd    string
 	Proxy     string
+	ProxyPool *common.ProxyPool // rotate proxies, nil: use Proxy
+	// account of common.RotatePerAccount, default EmailAddr
+	ProxyAccount string
+	Logger       common.Logger  // nil: drop all logs
+	Metrics      common.Metrics // nil: drop all metrics
+	Tracer       common.Tracer  // nil: no tracing
 }
 
 // OpenAI Authentication Reverse Engineered
@@ -31,17 +39,56 @@ type Authenticator struct {
 	accessToken  string
 	jar          tls_client.CookieJar
 	cfg          *AuthConfig
+	logger       *common.SafeLogger
+	metrics      common.Metrics
+	tracer       common.Tracer
 }
 
 func NewAuthenticator(cfg *AuthConfig) *Authenticator {
+	metrics := cfg.Metrics
+	if metrics == nil {
+		metrics = common.NopMetrics{}
+	}
+	tracer := cfg.Tracer
+	if tracer == nil {
+		tracer = common.NopTracer{}
+	}
 	auth := &Authenticator{
-		jar: tls_client.NewCookieJar(),
-		cfg: cfg,
+		jar:     tls_client.NewCookieJar(),
+		cfg:     cfg,
+		logger:  common.NewSafeLogger(cfg.Logger),
+		metrics: metrics,
+		tracer:  tracer,
 	}
 	return auth
 }
 
+func (auth *Authenticator) proxyAccount() string {
+	if auth.cfg.ProxyAccount != "" {
+		return auth.cfg.ProxyAccount
+	}
+	return auth.cfg.EmailAddr
+}
+
+// login by email and password
 func (auth *Authenticator) Loin() error {
+	return auth.LoinContext(context.Background())
+}
+
+func (auth *Authenticator) LoinContext(ctx context.Context) (err error) {
+	ctx, span := auth.tracer.Start(ctx, "chatgptuno.auth.Login")
+	defer func() {
+		auth.metrics.IncLogin("password", common.MetricResult(err))
+		common.EndSpan(span, err)
+	}()
+	return auth.login(ctx)
+}
+
+func (auth *Authenticator) login(ctx context.Context) (err error) {
+	ctx, span := auth.tracer.Start(ctx, "chatgptuno.auth.csrf")
+	defer func() {
+		common.EndSpan(span, err)
+	}()
 	endpint := "https://explorer.api.openai.com/api/auth/csrf"
 	headers := http.Header{
 		"Host":            {"explorer.api.openai.com"},
@@ -53,7 +100,9 @@ func (auth *Authenticator) Loin() error {
 		"Accept-Encoding": {"gzip, deflate, br"},
 	}
 	client := NewRequests(auth.jar)
+	client.SetContext(ctx)
 	client.SetProxy(auth.cfg.Proxy)
+	client.SetProxyPool(auth.cfg.ProxyPool, auth.proxyAccount())
 	client.SetTimeout(30)
 	client.SetHeaders(headers)
 	resp, err := client.Get(endpint)
@@ -61,6 +110,8 @@ func (auth *Authenticator) Loin() error {
 		return fmt.Errorf("login openai failed: %s", err.Error())
 	}
 	defer resp.Body.Close()
+	auth.logger.Debug(ctx, "login step", "step", "login", "status", resp.StatusCode)
+	span.SetAttributes(common.Attribute(common.AttrHTTPStatus, resp.StatusCode))
 
 	resBody, err := io.ReadAll(resp.Body)
 	if err != nil {
@@ -75,13 +126,20 @@ func (auth *Authenticator) Loin() error {
 			return fmt.Errorf("login openai failed: %s, %d", body, resp.StatusCode)
 		}
 		auth.CsrfToken = csrfToken
-		auth.partOne(csrfToken)
+		// errors of the later steps do not fail the login, as before; they are logged and traced
+		if err := auth.partOne(ctx, csrfToken); err != nil {
+			auth.logger.Warn(ctx, "login step failed", "step", "partOne", "err", err.Error())
+		}
 		return nil
 	}
 	return fmt.Errorf("login openai failed: %s, %d", body, resp.StatusCode)
 }
 
-func (auth *Authenticator) partOne(csrfToken string) error {
+func (auth *Authenticator) partOne(ctx context.Context, csrfToken string) (err error) {
+	ctx, span := auth.tracer.Start(ctx, "chatgptuno.auth.partOne")
+	defer func() {
+		common.EndSpan(span, err)
+	}()
 	endpoint := "https://explorer.api.openai.com/api/auth/signin/auth0?prompt=login"
 	payload := `callbackUrl=%2F&` + fmt.Sprintf(`csrfToken=%s&json=true`, csrfToken)
 	headers := http.Header{
@@ -99,7 +157,9 @@ func (auth *Authenticator) partOne(csrfToken string) error {
 		"Accept-Encoding": {"gzip, deflate"},
 	}
 	client := NewRequests(auth.jar)
+	client.SetContext(ctx)
 	client.SetProxy(auth.cfg.Proxy)
+	client.SetProxyPool(auth.cfg.ProxyPool, auth.proxyAccount())
 	client.SetTimeout(30)
 	client.SetHeaders(headers)
 	client.SetBody(bytes.NewReader([]byte(payload)))
@@ -108,6 +168,8 @@ func (auth *Authenticator) partOne(csrfToken string) error {
 		return fmt.Errorf("login part one failed: %s", err.Error())
 	}
 	defer resp.Body.Close()
+	auth.logger.Debug(ctx, "login step", "step", "partOne", "status", resp.StatusCode)
+	span.SetAttributes(common.Attribute(common.AttrHTTPStatus, resp.StatusCode))
 
 	resBody, err := io.ReadAll(resp.Body)
 	if err != nil {
@@ -122,7 +184,7 @@ func (auth *Authenticator) partOne(csrfToken string) error {
 			return errors.New("you have been rate limited. Please try again later")
 		}
 		// part_two
-		err = auth.partTwo(url)
+		err = auth.partTwo(ctx, url)
 		if err != nil {
 			return err
 		}
@@ -132,7 +194,11 @@ func (auth *Authenticator) partOne(csrfToken string) error {
 	return fmt.Errorf("part one failed: %s, %d", body, resp.StatusCode)
 }
 
-func (auth *Authenticator) partTwo(endpoint string) error {
+func (auth *Authenticator) partTwo(ctx context.Context, endpoint string) (err error) {
+	ctx, span := auth.tracer.Start(ctx, "chatgptuno.auth.partTwo")
+	defer func() {
+		common.EndSpan(span, err)
+	}()
 	headers := http.Header{
 		"Host":            {"auth0.openai.com"},
 		"Accept":          {"text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8"},
@@ -142,7 +208,9 @@ func (auth *Authenticator) partTwo(endpoint string) error {
 		"Referer":         {"https://explorer.api.openai.com/"},
 	}
 	client := NewRequests(auth.jar)
+	client.SetContext(ctx)
 	client.SetProxy(auth.cfg.Proxy)
+	client.SetProxyPool(auth.cfg.ProxyPool, auth.proxyAccount())
 	client.SetTimeout(30)
 	client.SetHeaders(headers)
 	resp, err := client.Get(endpoint)
@@ -150,6 +218,8 @@ func (auth *Authenticator) partTwo(endpoint string) error {
 		return fmt.Errorf("login partTwo failed: %s", err.Error())
 	}
 	defer resp.Body.Close()
+	auth.logger.Debug(ctx, "login step", "step", "partTwo", "status", resp.StatusCode)
+	span.SetAttributes(common.Attribute(common.AttrHTTPStatus, resp.StatusCode))
 
 	resBody, err := io.ReadAll(resp.Body)
 	if err != nil {
@@ -168,7 +238,7 @@ func (auth *Authenticator) partTwo(endpoint string) error {
 		return fmt.Errorf("login openai partTwo failed:%s, %d", body, resp.StatusCode)
 	}
 	state := strings.Split(r[0][0], `"`)[0]
-	err = auth.partThree(state)
+	err = auth.partThree(ctx, state)
 	if err != nil {
 		return err
 	}
@@ -176,7 +246,11 @@ func (auth *Authenticator) partTwo(endpoint string) error {
 }
 
 // We use the state to get the login page
-func (auth *Authenticator) partThree(state string) error {
+func (auth *Authenticator) partThree(ctx context.Context, state string) (err error) {
+	ctx, span := auth.tracer.Start(ctx, "chatgptuno.auth.partThree")
+	defer func() {
+		common.EndSpan(span, err)
+	}()
 	endpoint := fmt.Sprintf("https://auth0.openai.com/u/login/identifier?state=%s", state)
 	headers := http.Header{
 		"Host":            {"auth0.openai.com"},
@@ -187,7 +261,9 @@ func (auth *Authenticator) partThree(state string) error {
 		"Referer":         {"https://explorer.api.openai.com/"},
 	}
 	client := NewRequests(auth.jar)
+	client.SetContext(ctx)
 	client.SetProxy(auth.cfg.Proxy)
+	client.SetProxyPool(auth.cfg.ProxyPool, auth.proxyAccount())
 	client.SetTimeout(30)
 	client.SetHeaders(headers)
 	resp, err := client.Get(endpoint)
@@ -195,6 +271,8 @@ func (auth *Authenticator) partThree(state string) error {
 		return fmt.Errorf("login partThree failed: %s", err.Error())
 	}
 	defer resp.Body.Close()
+	auth.logger.Debug(ctx, "login step", "step", "partThree", "status", resp.StatusCode)
+	span.SetAttributes(common.Attribute(common.AttrHTTPStatus, resp.StatusCode))
 
 	resBody, err := io.ReadAll(resp.Body)
 	if err != nil {
@@ -204,7 +282,7 @@ func (auth *Authenticator) partThree(state string) error {
 	if resp.StatusCode != 200 {
 		return fmt.Errorf("login openai partThree failed:%s, %d", body, resp.StatusCode)
 	}
-	err = auth.partFour(state)
+	err = auth.partFour(ctx, state)
 	if err != nil {
 		return err
 	}
@@ -212,7 +290,11 @@ func (auth *Authenticator) partThree(state string) error {
 }
 
 // We make a POST request to the login page with the captcha, email
-func (auth *Authenticator) partFour(state string) error {
+func (auth *Authenticator) partFour(ctx context.Context, state string) (err error) {
+	ctx, span := auth.tracer.Start(ctx, "chatgptuno.auth.partFour")
+	defer func() {
+		common.EndSpan(span, err)
+	}()
 	endpoint := fmt.Sprintf("https://auth0.openai.com/u/login/identifier?state=%s", state)
 	encodeEmail := url.QueryEscape(auth.cfg.EmailAddr) //123@gmail.com --> 123%40gmail.com
 	payload := fmt.Sprintf("state=%s&username=%s&js-available=false&webauthn-available=true&is", state, encodeEmail)
@@ -228,7 +310,9 @@ func (auth *Authenticator) partFour(state string) error {
 		"Content-Type":    {"application/x-www-form-urlencoded"},
 	}
 	client := NewRequests(auth.jar)
+	client.SetContext(ctx)
 	client.SetProxy(auth.cfg.Proxy)
+	client.SetProxyPool(auth.cfg.ProxyPool, auth.proxyAccount())
 	client.SetTimeout(30)
 	client.SetHeaders(headers)
 	client.SetBody(bytes.NewBuffer([]byte(payload)))
@@ -237,6 +321,8 @@ func (auth *Authenticator) partFour(state string) error {
 		return fmt.Errorf("login partFour failed: %s", err.Error())
 	}
 	defer resp.Body.Close()
+	auth.logger.Debug(ctx, "login step", "step", "partFour", "status", resp.StatusCode)
+	span.SetAttributes(common.Attribute(common.AttrHTTPStatus, resp.StatusCode))
 
 	resBody, err := io.ReadAll(resp.Body)
 	if err != nil {
@@ -246,7 +332,7 @@ func (auth *Authenticator) partFour(state string) error {
 	if resp.StatusCode != 302 && resp.StatusCode != 200 {
 		return fmt.Errorf("login openai partFour failed:%s, %d", body, resp.StatusCode)
 	}
-	err = auth.partFive(state)
+	err = auth.partFive(ctx, state)
 	if err != nil {
 		return err
 	}
@@ -254,7 +340,11 @@ func (auth *Authenticator) partFour(state string) error {
 }
 
 // We enter the password
-func (auth *Authenticator) partFive(state string) error {
+func (auth *Authenticator) partFive(ctx context.Context, state string) (err error) {
+	ctx, span := auth.tracer.Start(ctx, "chatgptuno.auth.partFive")
+	defer func() {
+		common.EndSpan(span, err)
+	}()
 	endpoint := fmt.Sprintf("https://auth0.openai.com/u/login/password?state=%s", state)
 	encodeEmail := url.QueryEscape(auth.cfg.EmailAddr)
 	encodedPasswd := url.QueryEscape(auth.cfg.Passwd)
@@ -270,7 +360,9 @@ func (auth *Authenticator) partFive(state string) error {
 		"Content-Type":    {"application/x-www-form-urlencoded"},
 	}
 	client := NewRequests(auth.jar)
+	client.SetContext(ctx)
 	client.SetProxy(auth.cfg.Proxy)
+	client.SetProxyPool(auth.cfg.ProxyPool, auth.proxyAccount())
 	client.SetTimeout(30)
 	client.SetHeaders(headers)
 	client.SetBody(bytes.NewBuffer([]byte(payload)))
@@ -279,6 +371,8 @@ func (auth *Authenticator) partFive(state string) error {
 		return fmt.Errorf("login partFive failed: %s", err.Error())
 	}
 	defer resp.Body.Close()
+	auth.logger.Debug(ctx, "login step", "step", "partFive", "status", resp.StatusCode)
+	span.SetAttributes(common.Attribute(common.AttrHTTPStatus, resp.StatusCode))
 
 	resBody, err := io.ReadAll(resp.Body)
 	if err != nil {
@@ -297,14 +391,18 @@ func (auth *Authenticator) partFive(state string) error {
 		return fmt.Errorf("login openai partFive failed:%s, %d", body, resp.StatusCode)
 	}
 	newState := strings.Split(r[0][0], `"`)[0]
-	err = auth.partSix(state, newState)
+	err = auth.partSix(ctx, state, newState)
 	if err != nil {
 		return err
 	}
 	return nil
 }
 
-func (auth *Authenticator) partSix(state, newState string) error {
+func (auth *Authenticator) partSix(ctx context.Context, state, newState string) (err error) {
+	ctx, span := auth.tracer.Start(ctx, "chatgptuno.auth.partSix")
+	defer func() {
+		common.EndSpan(span, err)
+	}()
 	endpoint := fmt.Sprintf("https://auth0.openai.com/authorize/resume?state=%s", newState)
 	headers := http.Header{
 		"Host":            {"auth0.openai.com"},
@@ -315,7 +413,9 @@ func (auth *Authenticator) partSix(state, newState string) error {
 		"Referer":         {fmt.Sprintf("https://auth0.openai.com/u/login/password?state=%s", state)},
 	}
 	client := NewRequests(auth.jar)
+	client.SetContext(ctx)
 	client.SetProxy(auth.cfg.Proxy)
+	client.SetProxyPool(auth.cfg.ProxyPool, auth.proxyAccount())
 	client.SetTimeout(30)
 	client.SetHeaders(headers)
 	resp, err := client.Get(endpoint)
@@ -323,6 +423,8 @@ func (auth *Authenticator) partSix(state, newState string) error {
 		return fmt.Errorf("login partSix failed: %s", err.Error())
 	}
 	defer resp.Body.Close()
+	auth.logger.Debug(ctx, "login step", "step", "partSix", "status", resp.StatusCode)
+	span.SetAttributes(common.Attribute(common.AttrHTTPStatus, resp.StatusCode))
 
 	resBody, err := io.ReadAll(resp.Body)
 	if err != nil {
@@ -333,14 +435,18 @@ func (auth *Authenticator) partSix(state, newState string) error {
 		return fmt.Errorf("login openai partSix failed:%s, %d", body, resp.StatusCode)
 	}
 	redirectUrl := resp.Header.Get("location")
-	err = auth.partSeven(redirectUrl, endpoint)
+	err = auth.partSeven(ctx, redirectUrl, endpoint)
 	if err != nil {
 		return err
 	}
 	return nil
 }
 
-func (auth *Authenticator) partSeven(redirectUrl, previousUrl string) error {
+func (auth *Authenticator) partSeven(ctx context.Context, redirectUrl, previousUrl string) (err error) {
+	ctx, span := auth.tracer.Start(ctx, "chatgptuno.auth.partSeven")
+	defer func() {
+		common.EndSpan(span, err)
+	}()
 	endpoint := redirectUrl
 	headers := http.Header{
 		"Host":            {"explorer.api.openai.com"},
@@ -351,7 +457,9 @@ func (auth *Authenticator) partSeven(redirectUrl, previousUrl string) error {
 		"Referer":         {previousUrl},
 	}
 	client := NewRequests(auth.jar)
+	client.SetContext(ctx)
 	client.SetProxy(auth.cfg.Proxy)
+	client.SetProxyPool(auth.cfg.ProxyPool, auth.proxyAccount())
 	client.SetTimeout(30)
 	client.SetHeaders(headers)
 	resp, err := client.Get(endpoint)
@@ -359,6 +467,8 @@ func (auth *Authenticator) partSeven(redirectUrl, previousUrl string) error {
 		return fmt.Errorf("login partSeven failed: %s", err.Error())
 	}
 	defer resp.Body.Close()
+	auth.logger.Debug(ctx, "login step", "step", "partSeven", "status", resp.StatusCode)
+	span.SetAttributes(common.Attribute(common.AttrHTTPStatus, resp.StatusCode))
 
 	resBody, err := io.ReadAll(resp.Body)
 	if err != nil {
@@ -372,14 +482,29 @@ func (auth *Authenticator) partSeven(redirectUrl, previousUrl string) error {
 	for _, item := range resp.Cookies() {
 		if item.Name == "__Secure-next-auth.session-token" {
 			auth.SessionToken = item.Value
-			return auth.GetAccessToken()
+			return auth.getAccessToken(ctx)
 		}
 	}
 	return fmt.Errorf("login openai partSeven failed:%s, %d", body, resp.StatusCode)
 }
 
-// Gets access token
+// Gets access token by session token
 func (auth *Authenticator) GetAccessToken() error {
+	return auth.GetAccessTokenContext(context.Background())
+}
+
+func (auth *Authenticator) GetAccessTokenContext(ctx context.Context) (err error) {
+	defer func() {
+		auth.metrics.IncLogin("session_token", common.MetricResult(err))
+	}()
+	return auth.getAccessToken(ctx)
+}
+
+func (auth *Authenticator) getAccessToken(ctx context.Context) (err error) {
+	ctx, span := auth.tracer.Start(ctx, "chatgptuno.auth.getAccessToken")
+	defer func() {
+		common.EndSpan(span, err)
+	}()
 	// auth.jar.SetCookies()
 	endpoint := "https://explorer.api.openai.com/api/auth/session"
 	u, _ := url.Parse(endpoint)
@@ -390,7 +515,9 @@ func (auth *Authenticator) GetAccessToken() error {
 		},
 	})
 	client := NewRequests(auth.jar)
+	client.SetContext(ctx)
 	client.SetProxy(auth.cfg.Proxy)
+	client.SetProxyPool(auth.cfg.ProxyPool, auth.proxyAccount())
 	client.SetTimeout(30)
 	// client.SetCookie()
 	resp, err := client.Get(endpoint)
@@ -398,6 +525,8 @@ func (auth *Authenticator) GetAccessToken() error {
 		return fmt.Errorf("login getAccessToken failed: %s", err.Error())
 	}
 	defer resp.Body.Close()
+	auth.logger.Debug(ctx, "login step", "step", "getAccessToken", "status", resp.StatusCode)
+	span.SetAttributes(common.Attribute(common.AttrHTTPStatus, resp.StatusCode))
 
 	resBody, err := io.ReadAll(resp.Body)
 	if err != nil {
@@ -3,15 +3,18 @@ package chatgptuno
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
-	"log"
 	"net/url"
 	"os"
 	"strings"
+	"time"
 
+	"github.com/billikeu/go-chatgpt/common"
+	"github.com/billikeu/go-chatgpt/pii"
 	http "github.com/bogdanfinn/fhttp"
 	tls_client "github.com/bogdanfinn/tls-client"
 	uuid "github.com/satori/go.uuid"
@@ -24,20 +27,50 @@ type ChatGPTUnoBot struct {
 	conversationId string
 	parentId       string
 	convMapping    *Mapping
+	logger         *common.SafeLogger
+	metrics        common.Metrics
+	tracer         common.Tracer
+	vault          *pii.Vault
+	endpoints      *endpoints // nil: a single base URL
+	proxyAccount   string     // account of common.RotatePerAccount, the same for login and requests
 }
 
 func NewChatGPTUnoBot(cfg *ChatGPTUnoConfig) *ChatGPTUnoBot {
+	logger := cfg.Logger
+	if logger == nil {
+		logger = common.NewStdLogger(nil, common.LevelInfo)
+	}
+	metrics := cfg.Metrics
+	if metrics == nil {
+		metrics = common.NopMetrics{}
+	}
+	tracer := cfg.Tracer
+	if tracer == nil {
+		tracer = common.NopTracer{}
+	}
 	chat := &ChatGPTUnoBot{
 		cfg:            cfg,
 		jar:            tls_client.NewCookieJar(),
 		conversationId: "",
 		parentId:       "",
 		convMapping:    NewMapping(),
+		logger:         common.NewSafeLogger(logger),
+		metrics:        metrics,
+		tracer:         tracer,
+		vault:          pii.NewVault(),
+		endpoints:      newEndpoints(cfg.BaseUrls, cfg.PinConversations, cfg.MaxPinned),
+		proxyAccount:   cfg.EmailAddr,
+	}
+	if chat.proxyAccount == "" {
+		chat.proxyAccount = cfg.AccessToken
 	}
 	return chat
 }
 
 func (chat *ChatGPTUnoBot) BaseURL() string {
+	if chat.endpoints != nil {
+		return chat.endpoints.best(nil)
+	}
 	// https://bypass.churchless.tech/api/
 	// https://chat.openai.com/backend-api
 	if chat.cfg.BaseUrl == "" {
@@ -63,8 +96,7 @@ func (chat *ChatGPTUnoBot) SetAccessToken(accessToken string) {
 		"Accept-Language":           "en-US,en;q=0.9",
 		"Referer":                   "https://chat.openai.com/chat",
 	}
-	log.Println(headers)
-
+	chat.logger.Debug(context.Background(), "set access token", "headers", headers)
 }
 
 func (chat *ChatGPTUnoBot) defaultHeaders(accessToken string, keepAlive ...bool) http.Header {
@@ -93,6 +125,10 @@ func (chat *ChatGPTUnoBot) Init() error {
 }
 
 func (chat *ChatGPTUnoBot) Login() error {
+	return chat.LoginContext(context.Background())
+}
+
+func (chat *ChatGPTUnoBot) LoginContext(ctx context.Context) error {
 	if chat.cfg.AccessToken == "" && (chat.cfg.EmailAddr == "" || chat.cfg.Passwd == "") {
 		return errors.New("auth info null")
 	}
@@ -101,14 +137,20 @@ func (chat *ChatGPTUnoBot) Login() error {
 		EmailAddr: chat.cfg.EmailAddr,
 		Passwd:    chat.cfg.Passwd,
 		Proxy:     chat.cfg.Proxy,
+		ProxyPool: chat.cfg.ProxyPool,
+		// login from the proxy of the later requests
+		ProxyAccount: chat.proxyAccount,
+		Logger:       chat.logger,
+		Metrics:      chat.metrics,
+		Tracer:       chat.tracer,
 	})
 	defer chat.SetAccessToken(auth.AccessToken())
 
 	if chat.cfg.SessionToken != "" {
 		auth.SessionToken = chat.cfg.SessionToken
-		err := auth.GetAccessToken()
+		err := auth.GetAccessTokenContext(ctx)
 		if err != nil {
-			log.Println(err)
+			chat.logger.Warn(ctx, "get access token by session token failed", "err", err)
 		}
 		if err == nil && auth.AccessToken() != "" {
 			chat.cfg.AccessToken = auth.AccessToken()
@@ -116,7 +158,7 @@ func (chat *ChatGPTUnoBot) Login() error {
 		}
 	}
 	// login
-	err := auth.Loin()
+	err := auth.LoinContext(ctx)
 	if err != nil {
 		return err
 	}
@@ -127,40 +169,123 @@ func (chat *ChatGPTUnoBot) Login() error {
 
 // The standard ChatGPT model: text-davinci-002-render-sha Turbo (Default for free users)
 func (chat *ChatGPTUnoBot) Ask(prompt, conversationId, parentId, model string, timeout int, callback func(chatRes *Response, err error)) (err error) {
-	defer func() {
-		if callback != nil && err != nil {
-			callback(nil, err)
-		}
-	}()
-	conversationId, parentId, err = chat.askBeforeInit(conversationId, parentId)
-	if err != nil {
-		return err
-	}
-	model = chat.getModelName(model)
+	return chat.AskContext(context.Background(), prompt, conversationId, parentId, model, timeout, callback)
+}
 
-	reqData := NewNextAction(prompt, conversationId, parentId, model)
-	u, _ := url.Parse(chat.BaseURL())
+// post the next action, the caller closes the body
+func (chat *ChatGPTUnoBot) postConversation(ctx context.Context, base string, reqData *NextAction, timeout int) (*http.Response, error) {
+	u, _ := url.Parse(base)
 	chat.jar.SetCookies(u, []*http.Cookie{
 		{
 			Name:  "library",
 			Value: "revChatGPT",
 		},
 	})
-	endpoint := fmt.Sprintf("%sconversation", chat.BaseURL())
 	client := NewRequests(chat.jar)
+	client.SetContext(ctx)
 	client.SetProxy(chat.cfg.Proxy)
+	client.SetProxyPool(chat.cfg.ProxyPool, chat.proxyAccount)
 	client.SetBody(bytes.NewReader(reqData.Byte()))
 	client.SetHeaders(chat.defaultHeaders(chat.cfg.AccessToken, true))
 	client.SetTimeout(timeout)
-	resp, err := client.Post(endpoint)
+	return client.Post(fmt.Sprintf("%sconversation", base))
+}
+
+// Ask with the caller's ctx, the request is canceled with ctx and traced as a child span
+func (chat *ChatGPTUnoBot) AskContext(ctx context.Context, prompt, conversationId, parentId, model string, timeout int, callback func(chatRes *Response, err error)) error {
+	return chat.askContext(ctx, prompt, conversationId, parentId, model, timeout, nil, callback)
+}
+
+// resolved gets the parent id the prompt is sent with, nil: ignore
+func (chat *ChatGPTUnoBot) askContext(ctx context.Context, prompt, conversationId, parentId, model string, timeout int, resolved func(parentId string), callback func(chatRes *Response, err error)) (err error) {
+	defer func() {
+		if callback != nil && err != nil {
+			callback(nil, err)
+		}
+	}()
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	ctx = common.EnsureRequestId(ctx)
+	ctx, span := chat.tracer.Start(ctx, "chatgptuno.Ask", common.Attribute(common.AttrBackend, common.BackendChatGPTUno))
+	var msgId, text string
+	var status, chunks, retries int
+	defer func() {
+		span.SetAttributes(
+			common.Attribute(common.AttrConversationId, conversationId),
+			common.Attribute(common.AttrMessageId, msgId),
+			common.Attribute(common.AttrHTTPStatus, status),
+			common.Attribute(common.AttrRetryCount, retries),
+			common.Attribute(common.AttrPromptTokens, common.EstimateTokens(prompt)),
+			common.Attribute(common.AttrCompletionTokens, common.EstimateTokens(text)),
+			common.Attribute(common.AttrChunks, chunks),
+		)
+		common.EndSpan(span, err)
+	}()
+	start := time.Now()
+	errType := "network"
+	defer func() {
+		chat.metrics.ObserveLatency(common.BackendChatGPTUno, common.MetricResult(err), time.Since(start))
+		if err != nil {
+			chat.metrics.IncError(common.BackendChatGPTUno, common.ClassifyError(err, errType), status)
+		}
+	}()
+	conversationId, parentId, err = chat.askBeforeInit(ctx, conversationId, parentId)
 	if err != nil {
 		return err
 	}
-	defer resp.Body.Close()
-	if resp.StatusCode != 200 {
-		err = fmt.Errorf("openai blocked your request %d", resp.StatusCode)
-		return err
+	if resolved != nil {
+		resolved(parentId)
+	}
+	model = chat.getModelName(model)
+	span.SetAttributes(common.Attribute(common.AttrModel, model), common.Attribute(common.AttrParentId, parentId))
+
+	reqData := NewNextAction(chat.redactPII(prompt), conversationId, parentId, model)
+	base := chat.baseURLFor(conversationId)
+	tried := map[string]bool{}
+	var resp *http.Response
+	var breaker *common.Breaker
+	for {
+		tried[base] = true
+		breaker = chat.cfg.Breakers.For(base, chat.cfg.AccessToken)
+		sent := false
+		if err = breaker.Allow(); err == nil {
+			sent = true
+			resp, err = chat.postConversation(ctx, base, reqData, timeout)
+			if err == nil {
+				status = resp.StatusCode
+				if status == 200 {
+					break
+				}
+				resp.Body.Close()
+				errType = "http"
+				err = fmt.Errorf("openai blocked your request %d", status)
+			}
+			breaker.Done(err, status)
+		}
+		if ctx.Err() != nil {
+			return err
+		}
+		if sent {
+			// an endpoint skipped by its open breaker is not a failed request
+			chat.endpoints.observe(base, false, 0, false)
+		}
+		next := chat.nextEndpoint(conversationId, tried)
+		if next == "" {
+			return err
+		}
+		chat.logger.Warn(ctx, "endpoint failed, switching", "base_url", base, "next", next, "err", err.Error())
+		chat.metrics.IncRetry(common.BackendChatGPTUno)
+		retries++
+		base, status, errType = next, 0, "network"
 	}
+	defer func() {
+		breaker.Done(err, status)
+	}()
+	defer resp.Body.Close()
+	chat.endpoints.observe(base, true, 0, false)
+	chat.endpoints.pinConversation(conversationId, base)
+	errType = "stream"
 	reader := bufio.NewReader(resp.Body)
 	for {
 		b, _, err := reader.ReadLine()
@@ -187,14 +312,24 @@ func (chat *ChatGPTUnoBot) Ask(prompt, conversationId, parentId, model string, t
 		body = body[6:]
 		res := NewResponse(body)
 		if res == nil {
-			log.Printf("err response:%s", body)
+			chat.logger.Warn(ctx, "err response", "conversation_id", conversationId, "body", body)
 			continue
 		}
+		chat.restorePII(res)
+		if res.Message.Author.Role == "assistant" && len(res.Message.Content.Parts) > 0 {
+			if chunks == 0 {
+				chat.metrics.ObserveFirstToken(common.BackendChatGPTUno, time.Since(start))
+			}
+			chunks++
+			text = strings.Join(res.Message.Content.Parts, "")
+			msgId = res.Message.ID
+		}
 		if callback != nil {
 			callback(res, nil)
 		}
 		if conversationId == "" {
 			conversationId = res.ConversationID
+			chat.endpoints.pinConversation(conversationId, base)
 		}
 		convNode := chat.convMapping.GetConversationNode(conversationId)
 		if convNode == nil {
@@ -211,13 +346,14 @@ func (chat *ChatGPTUnoBot) Ask(prompt, conversationId, parentId, model string, t
 		}
 		if res.Message.EndTurn && res.Message.Author.Role == "assistant" {
 			// change title: title == New chat or title == ""
-			go chat.autoChangConversationTitle(conversationId, res.Message.ID)
+			go chat.autoChangConversationTitle(common.DetachContext(ctx), conversationId, res.Message.ID)
 			// log.Println("stop.............")
 		}
 
 		// log.Println(res.Message.Metadata.FinishDetails, "----------------------------------------------------", isPrefix)
 	}
 	// log.Println(conversationId, parentId)
+	chat.metrics.ObserveAnswer(common.BackendChatGPTUno, time.Since(start), chunks, common.EstimateTokens(text))
 	return nil
 }
 
@@ -237,10 +373,16 @@ func (chat *ChatGPTUnoBot) Ask(prompt, conversationId, parentId, model string, t
 	    "has_missing_conversations": false
 	}
 */
-func (chat *ChatGPTUnoBot) getConversations(offset int, limit int) error {
+func (chat *ChatGPTUnoBot) getConversations(ctx context.Context, offset int, limit int) (err error) {
+	ctx, span := chat.tracer.Start(ctx, "chatgptuno.getConversations")
+	defer func() {
+		common.EndSpan(span, err)
+	}()
 	endpoint := fmt.Sprintf("%sconversations?offset=%d&limit=%d", chat.BaseURL(), offset, limit)
 	client := NewRequests(chat.jar)
+	client.SetContext(ctx)
 	client.SetProxy(chat.cfg.Proxy)
+	client.SetProxyPool(chat.cfg.ProxyPool, chat.proxyAccount)
 	client.SetHeaders(chat.defaultHeaders(chat.cfg.AccessToken))
 	client.SetTimeout(60)
 	// stream=True,
@@ -249,6 +391,7 @@ func (chat *ChatGPTUnoBot) getConversations(offset int, limit int) error {
 		return err
 	}
 	defer resp.Body.Close()
+	span.SetAttributes(common.Attribute(common.AttrHTTPStatus, resp.StatusCode))
 
 	b, err := io.ReadAll(resp.Body)
 	if err != nil {
@@ -265,7 +408,7 @@ func (chat *ChatGPTUnoBot) getConversations(offset int, limit int) error {
 		// conversation
 		conversationId := v.Get("id").String()
 		if conversationId == "" {
-			log.Println("need some update ?")
+			chat.logger.Warn(ctx, "conversation without id, need some update ?", "item", v.Raw)
 			continue
 		}
 		convNode := chat.convMapping.GetConversationNode(conversationId)
@@ -282,36 +425,88 @@ func (chat *ChatGPTUnoBot) getConversations(offset int, limit int) error {
 	return nil
 }
 
-func (chat *ChatGPTUnoBot) getMsgHistory(conversationId string) error {
-	endpoint := fmt.Sprintf("%sconversation/%s", chat.BaseURL(), conversationId)
+func (chat *ChatGPTUnoBot) getMsgHistory(ctx context.Context, conversationId string) (err error) {
+	body, err := chat.fetchHistory(ctx, conversationId)
+	if err != nil {
+		return err
+	}
+	convNode := chat.convMapping.GetConversationNode(conversationId)
+	if convNode == nil {
+		return errors.New("can not found conversation")
+	}
+	convNode.SetHistory(gjson.Parse(body))
+	return nil
+}
+
+// get the message tree of a conversation, for export or migration
+func (chat *ChatGPTUnoBot) GetConversation(ctx context.Context, conversationId string) (*ConversationTree, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	body, err := chat.fetchHistory(ctx, conversationId)
+	if err != nil {
+		return nil, err
+	}
+	tree := &ConversationTree{}
+	if err := json.Unmarshal([]byte(body), tree); err != nil {
+		return nil, fmt.Errorf("parse conversation err:%s", err.Error())
+	}
+	if tree.ConversationID == "" {
+		tree.ConversationID = conversationId
+	}
+	if convNode := chat.convMapping.GetConversationNode(conversationId); convNode != nil {
+		convNode.SetHistory(gjson.Parse(body))
+	}
+	return tree, nil
+}
+
+func (chat *ChatGPTUnoBot) fetchHistory(ctx context.Context, conversationId string) (body string, err error) {
+	ctx, span := chat.tracer.Start(ctx, "chatgptuno.getMsgHistory", common.Attribute(common.AttrConversationId, conversationId))
+	defer func() {
+		common.EndSpan(span, err)
+	}()
+	endpoint := fmt.Sprintf("%sconversation/%s", chat.baseURLFor(conversationId), conversationId)
 	client := NewRequests(chat.jar)
+	client.SetContext(ctx)
 	client.SetProxy(chat.cfg.Proxy)
+	client.SetProxyPool(chat.cfg.ProxyPool, chat.proxyAccount)
 	client.SetHeaders(chat.defaultHeaders(chat.cfg.AccessToken))
 	client.SetTimeout(60)
 	resp, err := client.Get(endpoint)
 	if err != nil {
-		return err
+		return "", err
 	}
 	defer resp.Body.Close()
+	span.SetAttributes(common.Attribute(common.AttrHTTPStatus, resp.StatusCode))
 
 	b, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return err
+		return "", err
 	}
-	body := string(b)
+	body = string(b)
 	if resp.StatusCode != 200 {
-		return fmt.Errorf("get msg history err:%s, %d", body, resp.StatusCode)
+		return "", fmt.Errorf("get msg history err:%s, %d", body, resp.StatusCode)
 	}
-	convNode := chat.convMapping.GetConversationNode(conversationId)
-	if convNode == nil {
-		return errors.New("can not found conversation")
+	return body, nil
+}
+
+// check the base URL and the access token by listing one conversation
+func (chat *ChatGPTUnoBot) Ping(ctx context.Context) error {
+	if ctx == nil {
+		ctx = context.Background()
 	}
-	convNode.SetHistory(gjson.Parse(body))
-	return nil
+	return chat.getConversations(ctx, 0, 1)
 }
 
 // Generate title for conversation
-func (chat *ChatGPTUnoBot) genTitle(conversationId, messageId string) (title string, err error) {
+func (chat *ChatGPTUnoBot) genTitle(ctx context.Context, conversationId, messageId string) (title string, err error) {
+	ctx, span := chat.tracer.Start(ctx, "chatgptuno.genTitle",
+		common.Attribute(common.AttrConversationId, conversationId),
+		common.Attribute(common.AttrMessageId, messageId),
+	)
+	defer func() {
+		common.EndSpan(span, err)
+	}()
 	data := map[string]string{
 		"message_id": messageId,
 		"model":      "text-davinci-002-render",
@@ -320,9 +515,11 @@ func (chat *ChatGPTUnoBot) genTitle(conversationId, messageId string) (title str
 	if err != nil {
 		return title, fmt.Errorf("gen title err:%s", err.Error())
 	}
-	endpoint := fmt.Sprintf("%sconversation/gen_title/%s", chat.BaseURL(), conversationId)
+	endpoint := fmt.Sprintf("%sconversation/gen_title/%s", chat.baseURLFor(conversationId), conversationId)
 	client := NewRequests(chat.jar)
+	client.SetContext(ctx)
 	client.SetProxy(chat.cfg.Proxy)
+	client.SetProxyPool(chat.cfg.ProxyPool, chat.proxyAccount)
 	client.SetHeaders(chat.defaultHeaders(chat.cfg.AccessToken))
 	client.SetTimeout(60)
 	client.SetBody(bytes.NewReader(b))
@@ -331,6 +528,7 @@ func (chat *ChatGPTUnoBot) genTitle(conversationId, messageId string) (title str
 		return title, fmt.Errorf("gen title err:%s", err.Error())
 	}
 	defer resp.Body.Close()
+	span.SetAttributes(common.Attribute(common.AttrHTTPStatus, resp.StatusCode))
 
 	b, err = io.ReadAll(resp.Body)
 	if err != nil {
@@ -346,15 +544,21 @@ func (chat *ChatGPTUnoBot) genTitle(conversationId, messageId string) (title str
 }
 
 // change title of conversation
-func (chat *ChatGPTUnoBot) changeTitle(conversationId, title string) error {
+func (chat *ChatGPTUnoBot) changeTitle(ctx context.Context, conversationId, title string) (err error) {
+	ctx, span := chat.tracer.Start(ctx, "chatgptuno.changeTitle", common.Attribute(common.AttrConversationId, conversationId))
+	defer func() {
+		common.EndSpan(span, err)
+	}()
 	data := map[string]string{"title": title}
 	b, err := json.Marshal(data)
 	if err != nil {
 		return err
 	}
-	endpoint := fmt.Sprintf("%sconversation/%s", chat.BaseURL(), conversationId)
+	endpoint := fmt.Sprintf("%sconversation/%s", chat.baseURLFor(conversationId), conversationId)
 	client := NewRequests(chat.jar)
+	client.SetContext(ctx)
 	client.SetProxy(chat.cfg.Proxy)
+	client.SetProxyPool(chat.cfg.ProxyPool, chat.proxyAccount)
 	client.SetHeaders(chat.defaultHeaders(chat.cfg.AccessToken))
 	client.SetTimeout(60)
 	client.SetBody(bytes.NewReader(b))
@@ -363,6 +567,7 @@ func (chat *ChatGPTUnoBot) changeTitle(conversationId, title string) error {
 		return err
 	}
 	defer resp.Body.Close()
+	span.SetAttributes(common.Attribute(common.AttrHTTPStatus, resp.StatusCode))
 
 	b, err = io.ReadAll(resp.Body)
 	if err != nil {
@@ -376,9 +581,19 @@ func (chat *ChatGPTUnoBot) changeTitle(conversationId, title string) error {
 }
 
 func (chat *ChatGPTUnoBot) DeleteConversation(conversationId string) error {
-	endpoint := fmt.Sprintf("%sconversation/%s", chat.BaseURL(), conversationId)
+	return chat.DeleteConversationContext(context.Background(), conversationId)
+}
+
+func (chat *ChatGPTUnoBot) DeleteConversationContext(ctx context.Context, conversationId string) (err error) {
+	ctx, span := chat.tracer.Start(ctx, "chatgptuno.DeleteConversation", common.Attribute(common.AttrConversationId, conversationId))
+	defer func() {
+		common.EndSpan(span, err)
+	}()
+	endpoint := fmt.Sprintf("%sconversation/%s", chat.baseURLFor(conversationId), conversationId)
 	client := NewRequests(chat.jar)
+	client.SetContext(ctx)
 	client.SetProxy(chat.cfg.Proxy)
+	client.SetProxyPool(chat.cfg.ProxyPool, chat.proxyAccount)
 	client.SetHeaders(chat.defaultHeaders(chat.cfg.AccessToken))
 	client.SetTimeout(60)
 	client.SetBody(bytes.NewReader([]byte(`{"is_visible": false}`)))
@@ -387,6 +602,7 @@ func (chat *ChatGPTUnoBot) DeleteConversation(conversationId string) error {
 		return err
 	}
 	defer resp.Body.Close()
+	span.SetAttributes(common.Attribute(common.AttrHTTPStatus, resp.StatusCode))
 
 	b, err := io.ReadAll(resp.Body)
 	if err != nil {
@@ -396,13 +612,24 @@ func (chat *ChatGPTUnoBot) DeleteConversation(conversationId string) error {
 	if resp.StatusCode != 200 {
 		return fmt.Errorf("delete conversation err:%s, %d", body, resp.StatusCode)
 	}
+	chat.endpoints.unpinConversation(conversationId)
 	return nil
 }
 
 func (chat *ChatGPTUnoBot) ClearConversations() error {
+	return chat.ClearConversationsContext(context.Background())
+}
+
+func (chat *ChatGPTUnoBot) ClearConversationsContext(ctx context.Context) (err error) {
+	ctx, span := chat.tracer.Start(ctx, "chatgptuno.ClearConversations")
+	defer func() {
+		common.EndSpan(span, err)
+	}()
 	endpoint := fmt.Sprintf("%sconversations", chat.BaseURL())
 	client := NewRequests(chat.jar)
+	client.SetContext(ctx)
 	client.SetProxy(chat.cfg.Proxy)
+	client.SetProxyPool(chat.cfg.ProxyPool, chat.proxyAccount)
 	client.SetHeaders(chat.defaultHeaders(chat.cfg.AccessToken))
 	client.SetTimeout(60)
 	client.SetBody(bytes.NewReader([]byte(`{"is_visible": false}`)))
@@ -411,6 +638,7 @@ func (chat *ChatGPTUnoBot) ClearConversations() error {
 		return err
 	}
 	defer resp.Body.Close()
+	span.SetAttributes(common.Attribute(common.AttrHTTPStatus, resp.StatusCode))
 
 	b, err := io.ReadAll(resp.Body)
 	if err != nil {
@@ -423,7 +651,7 @@ func (chat *ChatGPTUnoBot) ClearConversations() error {
 	return nil
 }
 
-func (chat *ChatGPTUnoBot) autoChangConversationTitle(convId, msgId string) {
+func (chat *ChatGPTUnoBot) autoChangConversationTitle(ctx context.Context, convId, msgId string) {
 	if convId == "" || msgId == "" {
 		return
 	}
@@ -433,23 +661,23 @@ func (chat *ChatGPTUnoBot) autoChangConversationTitle(convId, msgId string) {
 	}
 	if convNode.Title() == "" {
 		// refresh
-		err := chat.getConversations(0, 50)
+		err := chat.getConversations(ctx, 0, 50)
 		if err != nil {
-			log.Println(err)
+			chat.logger.Warn(ctx, "refresh conversations failed", "conversation_id", convId, "err", err)
 			return
 		}
 	}
 	if convNode.Title() != "New chat" {
 		return
 	}
-	title, err := chat.genTitle(convId, msgId)
+	title, err := chat.genTitle(ctx, convId, msgId)
 	if err != nil {
-		log.Println(err)
+		chat.logger.Warn(ctx, "gen title failed", "conversation_id", convId, "err", err)
 		return
 	}
-	err = chat.changeTitle(convId, "gochat:"+title)
+	err = chat.changeTitle(ctx, convId, "gochat:"+title)
 	if err != nil {
-		log.Println(err)
+		chat.logger.Warn(ctx, "change title failed", "conversation_id", convId, "err", err)
 		return
 	}
 }
@@ -464,7 +692,7 @@ func (chat *ChatGPTUnoBot) getModelName(model string) string {
 	return model
 }
 
-func (chat *ChatGPTUnoBot) askBeforeInit(conversationId, parentId string) (string, string, error) {
+func (chat *ChatGPTUnoBot) askBeforeInit(ctx context.Context, conversationId, parentId string) (string, string, error) {
 	// conversationId == ""
 	if conversationId == "" {
 		if parentId != "" {
@@ -481,7 +709,7 @@ func (chat *ChatGPTUnoBot) askBeforeInit(conversationId, parentId string) (strin
 			return conversationId, parentId, nil
 		}
 		// get conversation info from network
-		err := chat.getConversations(0, 50)
+		err := chat.getConversations(ctx, 0, 50)
 		if err != nil {
 			return conversationId, parentId, err
 		}
@@ -490,7 +718,7 @@ func (chat *ChatGPTUnoBot) askBeforeInit(conversationId, parentId string) (strin
 			return conversationId, uuid.NewV4().String(), nil
 		}
 		// get msg history
-		err = chat.getMsgHistory(conversationId)
+		err = chat.getMsgHistory(ctx, conversationId)
 		if err != nil {
 			return conversationId, parentId, err
 		}
@@ -1,5 +1,10 @@
 package chatgptuno
 
+import (
+	"github.com/billikeu/go-chatgpt/common"
+	"github.com/billikeu/go-chatgpt/pii"
+)
+
 type ChatGPTUnoConfig struct {
 	EmailAddr    string
 	Passwd       string
@@ -8,4 +13,16 @@ type ChatGPTUnoConfig struct {
 	Proxy        string
 	Model        string // model: text-davinci-002-render-paid text-davinci-002-render-sha
 	BaseUrl      string
+	// candidate base URLs, Ask uses the healthy one with the lowest latency and switches on failures; BaseUrl is ignored
+	BaseUrls []string
+	// keep every conversation on the base URL it was created on, for backends that do not share conversations
+	PinConversations bool
+	// conversations kept pinned, the least recently used one is unpinned first, default 10000
+	MaxPinned int
+	Logger    common.Logger        // nil: standard log package, tokens, cookies and passwords are always redacted
+	Metrics   common.Metrics       // nil: drop all metrics
+	Tracer    common.Tracer        // nil: no tracing
+	Redactor  *pii.Redactor        // replace PII in prompts with placeholders, restored in answers; nil: disable
+	Breakers  *common.BreakerGroup // circuit breaker per base URL and access token, nil: disable
+	ProxyPool *common.ProxyPool    // rotate proxies for requests and login, the account is EmailAddr or else AccessToken; nil: use Proxy
 }
@@ -0,0 +1,279 @@
+package chatgptuno
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// state of a candidate base URL
+type EndpointStatus struct {
+	URL      string
+	Healthy  bool
+	Latency  time.Duration // moving average of the probes, 0: not probed yet
+	Failures int           // consecutive failures
+	Checked  time.Time     // last probe
+}
+
+/*
+endpoints are the candidate base URLs of ChatGPTUnoConfig.BaseUrls. Ask uses the healthy one
+with the lowest latency and switches to the next one when a request fails, a conversation
+can be pinned to the base URL it was created on. Only the maxPinned most recently used
+conversations stay pinned.
+*/
+type endpoints struct {
+	list      []*EndpointStatus
+	pin       bool
+	maxPinned int
+	pinned    map[string]*list.Element // by conversation id
+	order     *list.List               // *pinnedConversation, most recently used first
+	sync.Mutex
+}
+
+type pinnedConversation struct {
+	conversationId string
+	url            string
+}
+
+// maxPinned <= 0: 10000
+func newEndpoints(urls []string, pinConversations bool, maxPinned int) *endpoints {
+	if maxPinned <= 0 {
+		maxPinned = 10000
+	}
+	e := &endpoints{pin: pinConversations, maxPinned: maxPinned, pinned: make(map[string]*list.Element), order: list.New()}
+	for _, v := range urls {
+		if v == "" {
+			continue
+		}
+		if !strings.HasSuffix(v, "/") {
+			v += "/"
+		}
+		e.list = append(e.list, &EndpointStatus{URL: v, Healthy: true})
+	}
+	if len(e.list) == 0 {
+		return nil
+	}
+	return e
+}
+
+// the healthy endpoint with the lowest latency, not probed ones come after probed ones in config order
+func (e *endpoints) best(exclude map[string]bool) string {
+	e.Lock()
+	defer e.Unlock()
+
+	var best *EndpointStatus
+	for _, v := range e.list {
+		if exclude[v.URL] {
+			continue
+		}
+		if best == nil || better(v, best) {
+			best = v
+		}
+	}
+	if best == nil {
+		return ""
+	}
+	return best.URL
+}
+
+func better(a, b *EndpointStatus) bool {
+	if a.Healthy != b.Healthy {
+		return a.Healthy
+	}
+	if !a.Healthy {
+		return a.Failures < b.Failures
+	}
+	if a.Latency == 0 || b.Latency == 0 {
+		return a.Latency != 0 && b.Latency == 0
+	}
+	return a.Latency < b.Latency
+}
+
+// the pinned endpoint of a conversation, "": not pinned
+func (e *endpoints) pinnedURL(conversationId string) string {
+	if e == nil || !e.pin || conversationId == "" {
+		return ""
+	}
+	e.Lock()
+	defer e.Unlock()
+
+	elem, ok := e.pinned[conversationId]
+	if !ok {
+		return ""
+	}
+	e.order.MoveToFront(elem)
+	return elem.Value.(*pinnedConversation).url
+}
+
+func (e *endpoints) pinConversation(conversationId, url string) {
+	if e == nil || !e.pin || conversationId == "" {
+		return
+	}
+	e.Lock()
+	defer e.Unlock()
+
+	if _, ok := e.pinned[conversationId]; ok {
+		return
+	}
+	e.pinned[conversationId] = e.order.PushFront(&pinnedConversation{conversationId: conversationId, url: url})
+	for e.order.Len() > e.maxPinned {
+		oldest := e.order.Remove(e.order.Back()).(*pinnedConversation)
+		delete(e.pinned, oldest.conversationId)
+	}
+}
+
+func (e *endpoints) unpinConversation(conversationId string) {
+	if e == nil {
+		return
+	}
+	e.Lock()
+	defer e.Unlock()
+
+	if elem, ok := e.pinned[conversationId]; ok {
+		e.order.Remove(elem)
+		delete(e.pinned, conversationId)
+	}
+}
+
+func (e *endpoints) get(url string) *EndpointStatus {
+	for _, v := range e.list {
+		if v.URL == url {
+			return v
+		}
+	}
+	return nil
+}
+
+// record a request result, latency 0: not measured
+func (e *endpoints) observe(url string, ok bool, latency time.Duration, probe bool) {
+	if e == nil {
+		return
+	}
+	e.Lock()
+	defer e.Unlock()
+
+	v := e.get(url)
+	if v == nil {
+		return
+	}
+	if probe {
+		v.Checked = time.Now()
+	}
+	if !ok {
+		v.Failures++
+		v.Healthy = false
+		return
+	}
+	v.Failures = 0
+	v.Healthy = true
+	if latency > 0 {
+		if v.Latency == 0 {
+			v.Latency = latency
+		} else {
+			v.Latency = (v.Latency*7 + latency*3) / 10
+		}
+	}
+}
+
+func (e *endpoints) status() []EndpointStatus {
+	e.Lock()
+	defer e.Unlock()
+
+	list := make([]EndpointStatus, 0, len(e.list))
+	for _, v := range e.list {
+		list = append(list, *v)
+	}
+	return list
+}
+
+// the base URL for a request of conversationId, "": any conversation
+func (chat *ChatGPTUnoBot) baseURLFor(conversationId string) string {
+	if url := chat.endpoints.pinnedURL(conversationId); url != "" {
+		return url
+	}
+	return chat.BaseURL()
+}
+
+// the next endpoint after a failed request, "": no other endpoint may be used
+func (chat *ChatGPTUnoBot) nextEndpoint(conversationId string, tried map[string]bool) string {
+	if chat.endpoints == nil || chat.endpoints.pinnedURL(conversationId) != "" {
+		return ""
+	}
+	return chat.endpoints.best(tried)
+}
+
+// states of the candidate base URLs, nil when ChatGPTUnoConfig.BaseUrls is not set
+func (chat *ChatGPTUnoBot) Endpoints() []EndpointStatus {
+	if chat.endpoints == nil {
+		return nil
+	}
+	return chat.endpoints.status()
+}
+
+// probe every candidate base URL now by listing one conversation
+func (chat *ChatGPTUnoBot) ProbeEndpoints(ctx context.Context) []EndpointStatus {
+	if chat.endpoints == nil {
+		return nil
+	}
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	var wg sync.WaitGroup
+	for _, v := range chat.endpoints.status() {
+		wg.Add(1)
+		go func(url string) {
+			defer wg.Done()
+			start := time.Now()
+			err := chat.probe(ctx, url)
+			chat.endpoints.observe(url, err == nil, time.Since(start), true)
+			if err != nil {
+				chat.logger.Warn(ctx, "endpoint probe failed", "base_url", url, "err", err.Error())
+			}
+		}(v.URL)
+	}
+	wg.Wait()
+	return chat.endpoints.status()
+}
+
+func (chat *ChatGPTUnoBot) probe(ctx context.Context, baseURL string) error {
+	client := NewRequests(chat.jar)
+	client.SetContext(ctx)
+	client.SetProxy(chat.cfg.Proxy)
+	client.SetProxyPool(chat.cfg.ProxyPool, chat.proxyAccount)
+	client.SetHeaders(chat.defaultHeaders(chat.cfg.AccessToken))
+	client.SetTimeout(10)
+	resp, err := client.Get(fmt.Sprintf("%sconversations?offset=0&limit=1", baseURL))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != 200 {
+		return fmt.Errorf("probe status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// probe the candidate base URLs every interval until ctx is done
+func (chat *ChatGPTUnoBot) StartProbing(ctx context.Context, interval time.Duration) {
+	if chat.endpoints == nil {
+		return
+	}
+	if interval <= 0 {
+		interval = time.Minute
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			chat.ProbeEndpoints(ctx)
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
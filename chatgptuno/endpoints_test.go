@@ -0,0 +1,76 @@
+package chatgptuno
+
+import (
+	"testing"
+	"time"
+)
+
+func TestEndpointsBest(t *testing.T) {
+	tests := []struct {
+		name    string
+		observe func(e *endpoints)
+		exclude map[string]bool
+		want    string
+	}{
+		{"config order without probes", func(e *endpoints) {}, nil, "http://a/"},
+		{"lowest latency", func(e *endpoints) {
+			e.observe("http://a/", true, 30*time.Millisecond, true)
+			e.observe("http://b/", true, 10*time.Millisecond, true)
+		}, nil, "http://b/"},
+		{"probed before unprobed", func(e *endpoints) {
+			e.observe("http://c/", true, 50*time.Millisecond, true)
+		}, nil, "http://c/"},
+		{"healthy before failed", func(e *endpoints) {
+			e.observe("http://a/", false, 0, false)
+		}, nil, "http://b/"},
+		{"fewest failures when all failed", func(e *endpoints) {
+			e.observe("http://a/", false, 0, false)
+			e.observe("http://a/", false, 0, false)
+			e.observe("http://b/", false, 0, false)
+			e.observe("http://c/", false, 0, false)
+		}, nil, "http://b/"},
+		{"excluded", func(e *endpoints) {}, map[string]bool{"http://a/": true, "http://b/": true}, "http://c/"},
+		{"all excluded", func(e *endpoints) {}, map[string]bool{"http://a/": true, "http://b/": true, "http://c/": true}, ""},
+	}
+	for _, tt := range tests {
+		e := newEndpoints([]string{"http://a", "http://b/", "", "http://c"}, false, 0)
+		tt.observe(e)
+		if got := e.best(tt.exclude); got != tt.want {
+			t.Errorf("%s: best = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+	if newEndpoints(nil, true, 0) != nil {
+		t.Errorf("newEndpoints without urls is not nil")
+	}
+}
+
+func TestEndpointsPinned(t *testing.T) {
+	e := newEndpoints([]string{"http://a/", "http://b/"}, true, 2)
+	e.pinConversation("c1", "http://a/")
+	e.pinConversation("c1", "http://b/") // the first pin wins
+	e.pinConversation("c2", "http://b/")
+	e.pinnedURL("c1") // c1 is used, c2 is the oldest
+	e.pinConversation("c3", "http://a/")
+
+	tests := []struct {
+		conversationId string
+		want           string
+	}{
+		{"c1", "http://a/"},
+		{"c2", ""},
+		{"c3", "http://a/"},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := e.pinnedURL(tt.conversationId); got != tt.want {
+			t.Errorf("pinnedURL(%q) = %q, want %q", tt.conversationId, got, tt.want)
+		}
+	}
+	e.unpinConversation("c1")
+	if got := e.pinnedURL("c1"); got != "" {
+		t.Errorf("pinnedURL after unpin = %q", got)
+	}
+	if n := e.order.Len(); n != 1 {
+		t.Errorf("%d conversations pinned, want 1", n)
+	}
+}
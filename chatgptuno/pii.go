@@ -0,0 +1,23 @@
+package chatgptuno
+
+func (chat *ChatGPTUnoBot) redactPII(prompt string) string {
+	if chat.cfg.Redactor == nil {
+		return prompt
+	}
+	return chat.cfg.Redactor.Redact(chat.vault, prompt)
+}
+
+// restore PII placeholders in the parts of an assistant message, Raw keeps the placeholders
+func (chat *ChatGPTUnoBot) restorePII(res *Response) {
+	if chat.cfg.Redactor == nil || res.Message.Author.Role != "assistant" {
+		return
+	}
+	done := res.Message.EndTurn || res.Message.Metadata.FinishDetails.Type != ""
+	for i, part := range res.Message.Content.Parts {
+		if done {
+			res.Message.Content.Parts[i] = chat.vault.Restore(part)
+		} else {
+			res.Message.Content.Parts[i] = chat.vault.RestorePartial(part)
+		}
+	}
+}
@@ -2,8 +2,11 @@ package chatgptuno
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"io"
 
+	"github.com/billikeu/go-chatgpt/common"
 	http "github.com/bogdanfinn/fhttp"
 
 	tls_client "github.com/bogdanfinn/tls-client"
@@ -16,10 +19,13 @@ type Requests struct {
 	headers      http.Header
 	timeout      int
 	proxy        string
+	proxyPool    *common.ProxyPool
+	account      string
 	allowRediret bool
 	response     *http.Response
 	reqReader    io.Reader
 	cookies      map[string]string
+	ctx          context.Context
 }
 
 func NewRequests(jar http.CookieJar) *Requests {
@@ -53,6 +59,17 @@ func (r *Requests) SetProxy(proxy string) {
 	r.proxy = proxy
 }
 
+// send the request through the next proxy of pool, it replaces SetProxy; account: the key of common.RotatePerAccount
+func (r *Requests) SetProxyPool(pool *common.ProxyPool, account string) {
+	r.proxyPool = pool
+	r.account = account
+}
+
+// the request is canceled with ctx
+func (r *Requests) SetContext(ctx context.Context) {
+	r.ctx = ctx
+}
+
 func (r *Requests) SetNoRedirects() {
 	r.allowRediret = false
 }
@@ -70,16 +87,41 @@ func (r *Requests) Do(method, baseUrl string) (*http.Response, error) {
 	if err != nil {
 		return nil, err
 	}
-	req, err := http.NewRequest(method, baseUrl, r.reqReader)
+	ctx := r.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	req, err := http.NewRequestWithContext(ctx, method, baseUrl, r.reqReader)
 	if err != nil {
 		return nil, err
 	}
 	req.Header = r.headers
-	if r.proxy != "" {
-		client.SetProxy(r.proxy)
+	proxy := r.proxy
+	if r.proxyPool != nil {
+		proxy, err = r.proxyPool.Next(r.account)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if proxy != "" {
+		u, err := tlsProxy(proxy)
+		if err == nil {
+			err = client.SetProxy(u)
+		}
+		if err != nil {
+			r.proxyPool.Done(proxy, err)
+			return nil, err
+		}
 	}
 	resp, err := client.Do(req)
 	r.response = resp
+	if r.proxyPool != nil {
+		if err == nil && resp.StatusCode == http.StatusProxyAuthRequired {
+			r.proxyPool.Done(proxy, errors.New("proxy authentication required"))
+		} else {
+			r.proxyPool.Done(proxy, err)
+		}
+	}
 	return resp, err
 }
 
@@ -98,3 +140,18 @@ func (r *Requests) Post(baseUrl string) (*http.Response, error) {
 func (r *Requests) Patch(baseUrl string) (*http.Response, error) {
 	return r.Do(http.MethodPatch, baseUrl)
 }
+
+/*
+the proxy in the form of tls_client. It has no socks5h scheme, but its socks5 dialer sends the
+host name to the proxy, so names are resolved by the proxy for both socks5 and socks5h.
+*/
+func tlsProxy(proxy string) (string, error) {
+	u, err := common.ParseProxy(proxy)
+	if err != nil || u == nil {
+		return "", err
+	}
+	if u.Scheme == "socks5h" {
+		u.Scheme = "socks5"
+	}
+	return u.String(), nil
+}
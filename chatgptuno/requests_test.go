@@ -0,0 +1,96 @@
+package chatgptuno
+
+import (
+	"io"
+	"net"
+	"strconv"
+	"testing"
+)
+
+func TestTLSProxy(t *testing.T) {
+	tests := []struct {
+		proxy   string
+		want    string
+		wantErr bool
+	}{
+		{"", "", false},
+		{"127.0.0.1:3128", "http://127.0.0.1:3128", false},
+		{"socks5://127.0.0.1", "socks5://127.0.0.1:1080", false},
+		{"socks5h://u:p@127.0.0.1:1081", "socks5://u:p@127.0.0.1:1081", false},
+		{"ftp://127.0.0.1", "", true},
+	}
+	for _, tt := range tests {
+		got, err := tlsProxy(tt.proxy)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("tlsProxy(%q) = %q, %v, want %q", tt.proxy, got, err, tt.want)
+		}
+	}
+}
+
+// the host name reaches the socks5h proxy unresolved
+func TestRequestsSocks5hResolvesOnProxy(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	target := make(chan string, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		target <- socks5Target(conn)
+	}()
+
+	r := NewRequests(nil)
+	r.SetTimeout(5)
+	r.SetProxy("socks5h://" + ln.Addr().String())
+	if _, err := r.Get("https://chat.example.invalid/"); err == nil {
+		t.Fatalf("request through the refusing proxy succeeded")
+	}
+	if got := <-target; got != "chat.example.invalid:443" {
+		t.Errorf("proxy got target %q, want the unresolved host", got)
+	}
+}
+
+// read the greeting and the CONNECT request of a socks5 client, then refuse it
+func socks5Target(conn net.Conn) string {
+	buf := make([]byte, 262)
+	if _, err := io.ReadFull(conn, buf[:2]); err != nil {
+		return ""
+	}
+	if _, err := io.ReadFull(conn, buf[:buf[1]]); err != nil {
+		return ""
+	}
+	conn.Write([]byte{5, 0})
+	if _, err := io.ReadFull(conn, buf[:4]); err != nil {
+		return ""
+	}
+	var host string
+	switch buf[3] {
+	case 3: // domain name
+		if _, err := io.ReadFull(conn, buf[:1]); err != nil {
+			return ""
+		}
+		n := int(buf[0])
+		if _, err := io.ReadFull(conn, buf[:n]); err != nil {
+			return ""
+		}
+		host = string(buf[:n])
+	case 1:
+		if _, err := io.ReadFull(conn, buf[:4]); err != nil {
+			return ""
+		}
+		host = net.IP(buf[:4]).String()
+	default:
+		return ""
+	}
+	if _, err := io.ReadFull(conn, buf[:2]); err != nil {
+		return ""
+	}
+	port := int(buf[0])<<8 | int(buf[1])
+	conn.Write([]byte{5, 5, 0, 1, 0, 0, 0, 0, 0, 0})
+	return net.JoinHostPort(host, strconv.Itoa(port))
+}
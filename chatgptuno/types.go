@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"sync"
 
+	"github.com/billikeu/go-chatgpt/params"
 	uuid "github.com/satori/go.uuid"
 	"github.com/tidwall/gjson"
 )
@@ -118,6 +119,17 @@ type FinishDetail struct {
 	Stop string `json:"stop"`
 }
 
+// Type as a finish reason of the openai api: stop, length, stopped
+func (detail FinishDetail) Reason() string {
+	switch detail.Type {
+	case "max_tokens":
+		return "length"
+	case "interrupted":
+		return params.FinishReasonStopped
+	}
+	return detail.Type
+}
+
 func NewResponse(text string) *Response {
 	res := &Response{}
 	err := json.Unmarshal([]byte(text), res)
@@ -130,6 +142,47 @@ func NewResponse(text string) *Response {
 
 // response msg end -----------------------------------------------------------
 
+// conversation tree begin ++++++++++++++++++++++++++++++++++++++++++++++++++++++
+
+// ConversationTree is the message history of a conversation, see GetConversation.
+// Every edit or regenerate adds a branch, CurrentNode is the last message of the shown branch.
+type ConversationTree struct {
+	ConversationID string               `json:"conversation_id"`
+	Title          string               `json:"title"`
+	CreateTime     float64              `json:"create_time"`
+	UpdateTime     float64              `json:"update_time"`
+	Mapping        map[string]*TreeNode `json:"mapping"`
+	CurrentNode    string               `json:"current_node"`
+}
+
+type TreeNode struct {
+	ID       string   `json:"id"`
+	Message  *Message `json:"message"` // nil for the root
+	Parent   string   `json:"parent"`
+	Children []string `json:"children"`
+}
+
+// messages from the root to nodeId, "": CurrentNode
+func (tree *ConversationTree) Branch(nodeId string) []*Message {
+	if nodeId == "" {
+		nodeId = tree.CurrentNode
+	}
+	var messages []*Message
+	seen := map[string]bool{}
+	for node := tree.Mapping[nodeId]; node != nil && !seen[node.ID]; node = tree.Mapping[node.Parent] {
+		seen[node.ID] = true
+		if node.Message != nil {
+			messages = append(messages, node.Message)
+		}
+	}
+	for i, j := 0, len(messages)-1; i < j; i, j = i+1, j-1 {
+		messages[i], messages[j] = messages[j], messages[i]
+	}
+	return messages
+}
+
+// conversation tree end --------------------------------------------------------
+
 // conversation node begin ++++++++++++++++++++++++++++++++++++++++++++++++++++++
 
 type ConversationNode struct {
@@ -0,0 +1,307 @@
+package common
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+type BreakerState int
+
+const (
+	// requests pass, failures are counted
+	StateClosed BreakerState = iota
+	// requests fail fast with CircuitOpenError until OpenTimeout passed
+	StateOpen
+	// a few trial requests pass, a success closes the breaker, a failure opens it again
+	StateHalfOpen
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case StateClosed:
+		return "closed"
+	case StateOpen:
+		return "open"
+	case StateHalfOpen:
+		return "half_open"
+	}
+	return "unknown"
+}
+
+// matched by errors.Is for every CircuitOpenError
+var ErrCircuitOpen = errors.New("circuit open")
+
+// returned instead of sending a request to an endpoint whose breaker is open
+type CircuitOpenError struct {
+	Key        string        // base URL and account hash of the breaker
+	RetryAfter time.Duration // until the breaker lets a trial request pass, 0: trials are running
+}
+
+func (e *CircuitOpenError) Error() string {
+	return fmt.Sprintf("circuit open for %s, retry after %s", e.Key, e.RetryAfter.Round(time.Millisecond))
+}
+
+func (e *CircuitOpenError) Is(target error) bool {
+	return target == ErrCircuitOpen
+}
+
+type BreakerConfig struct {
+	// consecutive failures that open the breaker, default 5
+	FailureThreshold int
+	// time the breaker stays open before trial requests, default 30s
+	OpenTimeout time.Duration
+	// concurrent trial requests in half open state, default 1
+	HalfOpenRequests int
+	// whether err of a request with http status (0: unknown) is a failure of the endpoint, default IsEndpointFailure
+	IsFailure func(err error, status int) bool
+	// called after the state of the breaker of key changed
+	OnStateChange func(key string, from, to BreakerState)
+}
+
+/*
+IsEndpointFailure is the default of BreakerConfig.IsFailure: network errors, timeouts, 5xx,
+401, 403, 408 and 429 are failures. Canceled requests and other 4xx are not, they are
+errors of the request rather than of the endpoint.
+*/
+func IsEndpointFailure(err error, status int) bool {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return false
+	}
+	if status >= 400 && status < 500 {
+		switch status {
+		case 401, 403, 408, 429:
+			return true
+		}
+		return false
+	}
+	return true
+}
+
+/*
+Breaker is a circuit breaker of one endpoint, see BreakerGroup. A nil Breaker lets every request pass.
+
+	if err := breaker.Allow(); err != nil {
+		return err // *common.CircuitOpenError
+	}
+	resp, err := send()
+	breaker.Done(err, resp.StatusCode)
+*/
+type Breaker struct {
+	key      string
+	cfg      BreakerConfig
+	state    BreakerState
+	failures int
+	openedAt time.Time
+	trials   int // running trial requests
+	sync.Mutex
+}
+
+func NewBreaker(key string, cfg BreakerConfig) *Breaker {
+	if cfg.FailureThreshold <= 0 {
+		cfg.FailureThreshold = 5
+	}
+	if cfg.OpenTimeout <= 0 {
+		cfg.OpenTimeout = 30 * time.Second
+	}
+	if cfg.HalfOpenRequests <= 0 {
+		cfg.HalfOpenRequests = 1
+	}
+	if cfg.IsFailure == nil {
+		cfg.IsFailure = IsEndpointFailure
+	}
+	return &Breaker{key: key, cfg: cfg}
+}
+
+func (b *Breaker) Key() string {
+	if b == nil {
+		return ""
+	}
+	return b.key
+}
+
+func (b *Breaker) State() BreakerState {
+	if b == nil {
+		return StateClosed
+	}
+	b.Lock()
+	defer b.Unlock()
+
+	if b.state == StateOpen && time.Since(b.openedAt) >= b.cfg.OpenTimeout {
+		return StateHalfOpen
+	}
+	return b.state
+}
+
+// nil: the request may be sent and Done must be called with its result
+func (b *Breaker) Allow() error {
+	if b == nil {
+		return nil
+	}
+	var notify func()
+	defer func() {
+		if notify != nil {
+			notify()
+		}
+	}()
+	b.Lock()
+	defer b.Unlock()
+
+	if b.state == StateOpen {
+		if wait := b.cfg.OpenTimeout - time.Since(b.openedAt); wait > 0 {
+			return &CircuitOpenError{Key: b.key, RetryAfter: wait}
+		}
+		notify = b.setState(StateHalfOpen)
+		b.trials = 0
+	}
+	if b.state == StateHalfOpen {
+		if b.trials >= b.cfg.HalfOpenRequests {
+			return &CircuitOpenError{Key: b.key}
+		}
+		b.trials++
+	}
+	return nil
+}
+
+// record the result of an allowed request, status: http status or 0
+func (b *Breaker) Done(err error, status int) {
+	if b == nil {
+		return
+	}
+	failure := b.cfg.IsFailure(err, status)
+	var notify func()
+	defer func() {
+		if notify != nil {
+			notify()
+		}
+	}()
+	b.Lock()
+	defer b.Unlock()
+
+	switch b.state {
+	case StateClosed:
+		if failure {
+			b.failures++
+			if b.failures >= b.cfg.FailureThreshold {
+				notify = b.open()
+			}
+			return
+		}
+		if err == nil {
+			b.failures = 0
+		}
+	case StateHalfOpen:
+		if b.trials > 0 {
+			b.trials--
+		}
+		if failure {
+			notify = b.open()
+			return
+		}
+		if errors.Is(err, context.Canceled) {
+			// the trial proved nothing
+			return
+		}
+		b.failures = 0
+		notify = b.setState(StateClosed)
+	}
+	// StateOpen: a request allowed before the breaker opened
+}
+
+func (b *Breaker) open() func() {
+	b.openedAt = time.Now()
+	b.trials = 0
+	return b.setState(StateOpen)
+}
+
+// change the state, the returned func calls OnStateChange and is run without the lock
+func (b *Breaker) setState(state BreakerState) func() {
+	from := b.state
+	b.state = state
+	if from == state || b.cfg.OnStateChange == nil {
+		return nil
+	}
+	key, fn := b.key, b.cfg.OnStateChange
+	return func() {
+		fn(key, from, state)
+	}
+}
+
+// the breaker key of an endpoint and account, the account (api key or access token) is hashed
+func BreakerKey(baseURL, account string) string {
+	if account == "" {
+		return baseURL
+	}
+	sum := sha256.Sum256([]byte(account))
+	return baseURL + "#" + hex.EncodeToString(sum[:6])
+}
+
+/*
+BreakerGroup holds one Breaker per base URL and account, share it between clients of the same endpoints.
+A nil BreakerGroup has no breakers.
+
+	breakers := common.NewBreakerGroup(common.BreakerConfig{
+		FailureThreshold: 5,
+		OpenTimeout:      time.Minute,
+		OnStateChange: func(key string, from, to common.BreakerState) {
+			log.Println(key, from, "->", to)
+		},
+	})
+	conversation.SetBreakers(breakers)
+*/
+type BreakerGroup struct {
+	cfg      BreakerConfig
+	breakers map[string]*Breaker
+	sync.Mutex
+}
+
+func NewBreakerGroup(cfg BreakerConfig) *BreakerGroup {
+	return &BreakerGroup{cfg: cfg, breakers: make(map[string]*Breaker)}
+}
+
+// the breaker of key, created on first use
+func (g *BreakerGroup) Get(key string) *Breaker {
+	if g == nil {
+		return nil
+	}
+	g.Lock()
+	defer g.Unlock()
+
+	b, ok := g.breakers[key]
+	if !ok {
+		b = NewBreaker(key, g.cfg)
+		g.breakers[key] = b
+	}
+	return b
+}
+
+// the breaker of an endpoint and account, see BreakerKey
+func (g *BreakerGroup) For(baseURL, account string) *Breaker {
+	if g == nil {
+		return nil
+	}
+	return g.Get(BreakerKey(baseURL, account))
+}
+
+// states of all breakers by key
+func (g *BreakerGroup) States() map[string]BreakerState {
+	if g == nil {
+		return nil
+	}
+	g.Lock()
+	breakers := make([]*Breaker, 0, len(g.breakers))
+	for _, v := range g.breakers {
+		breakers = append(breakers, v)
+	}
+	g.Unlock()
+
+	states := make(map[string]BreakerState, len(breakers))
+	for _, v := range breakers {
+		states[v.key] = v.State()
+	}
+	return states
+}
@@ -0,0 +1,194 @@
+package common
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestIsEndpointFailure(t *testing.T) {
+	failed := errors.New("request failed")
+	tests := []struct {
+		err    error
+		status int
+		want   bool
+	}{
+		{nil, 200, false},
+		{nil, 500, false},
+		{context.Canceled, 0, false},
+		{fmt.Errorf("wrapped: %w", context.Canceled), 0, false},
+		{context.DeadlineExceeded, 0, true},
+		{failed, 0, true},
+		{failed, 500, true},
+		{failed, 503, true},
+		{failed, 400, false},
+		{failed, 404, false},
+		{failed, 401, true},
+		{failed, 403, true},
+		{failed, 408, true},
+		{failed, 429, true},
+	}
+	for _, tt := range tests {
+		if got := IsEndpointFailure(tt.err, tt.status); got != tt.want {
+			t.Errorf("IsEndpointFailure(%v, %d) = %v, want %v", tt.err, tt.status, got, tt.want)
+		}
+	}
+}
+
+func TestBreaker(t *testing.T) {
+	var changes []string
+	b := NewBreaker("k", BreakerConfig{
+		FailureThreshold: 2,
+		OpenTimeout:      20 * time.Millisecond,
+		OnStateChange: func(key string, from, to BreakerState) {
+			changes = append(changes, from.String()+">"+to.String())
+		},
+	})
+	failed := errors.New("timeout")
+
+	// a success resets the count of consecutive failures
+	b.Done(failed, 0)
+	b.Done(nil, 200)
+	b.Done(failed, 0)
+	b.Done(errors.New("bad request"), 400)
+	if b.State() != StateClosed {
+		t.Fatalf("state = %s, want closed", b.State())
+	}
+	b.Done(failed, 0)
+	if b.State() != StateOpen {
+		t.Fatalf("state = %s, want open", b.State())
+	}
+	err := b.Allow()
+	var open *CircuitOpenError
+	if !errors.As(err, &open) || !errors.Is(err, ErrCircuitOpen) || open.Key != "k" || open.RetryAfter <= 0 {
+		t.Fatalf("Allow of an open breaker = %v", err)
+	}
+
+	time.Sleep(25 * time.Millisecond)
+	if b.State() != StateHalfOpen {
+		t.Fatalf("state after OpenTimeout = %s, want half_open", b.State())
+	}
+	// one trial, the next request fails fast
+	if err := b.Allow(); err != nil {
+		t.Fatalf("trial: %v", err)
+	}
+	if err := b.Allow(); !errors.As(err, &open) || open.RetryAfter != 0 {
+		t.Fatalf("second trial = %v", err)
+	}
+	// a failed trial opens the breaker again
+	b.Done(failed, 503)
+	if b.State() != StateOpen {
+		t.Fatalf("state after failed trial = %s, want open", b.State())
+	}
+
+	time.Sleep(25 * time.Millisecond)
+	// a canceled trial proves nothing and frees the slot
+	if err := b.Allow(); err != nil {
+		t.Fatal(err)
+	}
+	b.Done(context.Canceled, 0)
+	if b.State() != StateHalfOpen {
+		t.Fatalf("state after canceled trial = %s, want half_open", b.State())
+	}
+	if err := b.Allow(); err != nil {
+		t.Fatalf("trial after canceled trial: %v", err)
+	}
+	b.Done(nil, 200)
+	if b.State() != StateClosed {
+		t.Fatalf("state after successful trial = %s, want closed", b.State())
+	}
+
+	want := "closed>open,open>half_open,half_open>open,open>half_open,half_open>closed"
+	if got := strings.Join(changes, ","); got != want {
+		t.Errorf("state changes = %s, want %s", got, want)
+	}
+}
+
+func TestBreakerOpenTimeout(t *testing.T) {
+	timeout := 100 * time.Millisecond
+	b := NewBreaker("k", BreakerConfig{FailureThreshold: 1, OpenTimeout: timeout})
+	failed := errors.New("timeout")
+	retryAfter := func() time.Duration {
+		var open *CircuitOpenError
+		if err := b.Allow(); !errors.As(err, &open) {
+			t.Fatalf("Allow of an open breaker = %v", err)
+		}
+		return open.RetryAfter
+	}
+
+	b.Done(failed, 0)
+	first := retryAfter()
+	if first <= timeout/2 || first > timeout {
+		t.Errorf("RetryAfter right after opening = %s, want about %s", first, timeout)
+	}
+	time.Sleep(timeout / 2)
+	if second := retryAfter(); second <= 0 || second >= first || second > timeout/2 {
+		t.Errorf("RetryAfter after %s = %s, first %s", timeout/2, second, first)
+	}
+	if b.State() != StateOpen {
+		t.Errorf("state before OpenTimeout = %s", b.State())
+	}
+	time.Sleep(timeout/2 + 10*time.Millisecond)
+	if err := b.Allow(); err != nil {
+		t.Fatalf("trial after OpenTimeout: %v", err)
+	}
+	// a failed trial waits the whole OpenTimeout again
+	b.Done(failed, 0)
+	if again := retryAfter(); again <= timeout/2 || again > timeout {
+		t.Errorf("RetryAfter after a failed trial = %s", again)
+	}
+
+	// default OpenTimeout
+	b = NewBreaker("k", BreakerConfig{FailureThreshold: 1})
+	b.Done(failed, 0)
+	if d := retryAfter(); d <= 29*time.Second || d > 30*time.Second {
+		t.Errorf("RetryAfter with the default OpenTimeout = %s", d)
+	}
+}
+
+func TestBreakerNil(t *testing.T) {
+	var b *Breaker
+	if err := b.Allow(); err != nil {
+		t.Errorf("nil Allow = %v", err)
+	}
+	b.Done(errors.New("x"), 500)
+	if b.State() != StateClosed || b.Key() != "" {
+		t.Errorf("nil breaker state %s key %q", b.State(), b.Key())
+	}
+	var g *BreakerGroup
+	if g.For("https://api.openai.com/v1", "sk") != nil || g.States() != nil {
+		t.Errorf("nil group has breakers")
+	}
+}
+
+func TestBreakerGroup(t *testing.T) {
+	g := NewBreakerGroup(BreakerConfig{FailureThreshold: 1})
+	a := g.For("https://a/v1", "sk-1")
+	if g.For("https://a/v1", "sk-1") != a {
+		t.Errorf("For returned a new breaker for the same endpoint and account")
+	}
+	if g.For("https://a/v1", "sk-2") == a || g.For("https://b/v1", "sk-1") == a {
+		t.Errorf("endpoints or accounts share a breaker")
+	}
+	a.Done(errors.New("x"), 500)
+	states := g.States()
+	if len(states) != 3 || states[a.Key()] != StateOpen {
+		t.Errorf("States = %v", states)
+	}
+}
+
+func TestBreakerKey(t *testing.T) {
+	if got := BreakerKey("https://a/v1", ""); got != "https://a/v1" {
+		t.Errorf("BreakerKey without account = %q", got)
+	}
+	key := BreakerKey("https://a/v1", "sk-secret")
+	if strings.Contains(key, "sk-secret") || !strings.HasPrefix(key, "https://a/v1#") {
+		t.Errorf("BreakerKey = %q", key)
+	}
+	if key == BreakerKey("https://a/v1", "sk-other") || key != BreakerKey("https://a/v1", "sk-secret") {
+		t.Errorf("BreakerKey is not a stable hash of the account")
+	}
+}
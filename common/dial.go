@@ -2,48 +2,27 @@ package common
 
 import (
 	"context"
+	"fmt"
 	"net"
 	"strings"
-	"time"
-
-	"golang.org/x/net/proxy"
 )
 
 type DialContext func(ctx context.Context, network, addr string) (net.Conn, error)
 
+// socks5: [username:password@]host:port or a socks5:// or socks5h:// URL, "": dial directly
 func NewDialContext(socks5 string) (DialContext, error) {
-	baseDialer := &net.Dialer{
-		Timeout:   60 * time.Second,
-		KeepAlive: 60 * time.Second,
-	}
 	if socks5 == "" {
-		return baseDialer.DialContext, nil
+		return newBaseDialer().DialContext, nil
 	}
-
-	// split socks5 proxy string [username:password@]host:port
-	var auth *proxy.Auth = nil
-
-	if strings.Contains(socks5, "@") {
-		proxyInfo := strings.SplitN(socks5, "@", 2)
-		proxyUser := strings.Split(proxyInfo[0], ":")
-		if len(proxyUser) == 2 {
-			auth = &proxy.Auth{
-				User:     proxyUser[0],
-				Password: proxyUser[1],
-			}
-		}
-		socks5 = proxyInfo[1]
+	if !strings.Contains(socks5, "://") {
+		socks5 = "socks5://" + socks5
 	}
-
-	dialSocksProxy, err := proxy.SOCKS5("tcp", socks5, auth, baseDialer)
+	u, err := ParseProxy(socks5)
 	if err != nil {
 		return nil, err
 	}
-
-	contextDialer, ok := dialSocksProxy.(proxy.ContextDialer)
-	if !ok {
-		return nil, err
+	if u.Scheme != "socks5" && u.Scheme != "socks5h" {
+		return nil, fmt.Errorf("not a socks5 proxy: %s", u.Redacted())
 	}
-
-	return contextDialer.DialContext, nil
+	return socksDialContext(u)
 }
@@ -0,0 +1,276 @@
+package common
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/url"
+	"reflect"
+	"regexp"
+	"strings"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+// log level, the values are the same as log/slog
+type Level int
+
+const (
+	LevelDebug Level = -4
+	LevelInfo  Level = 0
+	LevelWarn  Level = 4
+	LevelError Level = 8
+)
+
+func (l Level) String() string {
+	switch {
+	case l < LevelInfo:
+		return "DEBUG"
+	case l < LevelWarn:
+		return "INFO"
+	case l < LevelError:
+		return "WARN"
+	default:
+		return "ERROR"
+	}
+}
+
+/*
+Logger is the logging interface used by the library, keyvals are alternating keys and values.
+
+	logger.Log(ctx, common.LevelInfo, "ask done", "chunks", 12)
+*/
+type Logger interface {
+	Log(ctx context.Context, level Level, msg string, keyvals ...interface{})
+}
+
+// drop all logs
+type NopLogger struct{}
+
+func (NopLogger) Log(ctx context.Context, level Level, msg string, keyvals ...interface{}) {}
+
+// write logs by the standard log package
+type StdLogger struct {
+	logger *log.Logger
+	level  Level
+}
+
+// logger == nil: log.Default()
+func NewStdLogger(logger *log.Logger, level Level) *StdLogger {
+	if logger == nil {
+		logger = log.Default()
+	}
+	return &StdLogger{logger: logger, level: level}
+}
+
+func (l *StdLogger) Log(ctx context.Context, level Level, msg string, keyvals ...interface{}) {
+	if level < l.level {
+		return
+	}
+	var b strings.Builder
+	b.WriteString(level.String())
+	b.WriteString(" ")
+	b.WriteString(msg)
+	for i := 0; i < len(keyvals); i += 2 {
+		b.WriteString(" ")
+		b.WriteString(fmt.Sprint(keyvals[i]))
+		b.WriteString("=")
+		if i+1 < len(keyvals) {
+			b.WriteString(fmt.Sprint(keyvals[i+1]))
+		}
+	}
+	l.logger.Output(2, b.String())
+}
+
+// request id begin ++++++++++++++++++++++++++++++++++++++++++++++++++++++++
+
+type requestIdKey struct{}
+
+func NewRequestId() string {
+	return uuid.NewV4().String()
+}
+
+// attach request id to ctx, it will be logged as request_id
+func WithRequestId(ctx context.Context, requestId string) context.Context {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return context.WithValue(ctx, requestIdKey{}, requestId)
+}
+
+func RequestId(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	requestId, _ := ctx.Value(requestIdKey{}).(string)
+	return requestId
+}
+
+// make sure ctx carries a request id
+func EnsureRequestId(ctx context.Context) context.Context {
+	if RequestId(ctx) != "" {
+		return ctx
+	}
+	return WithRequestId(ctx, NewRequestId())
+}
+
+// request id end ----------------------------------------------------------
+
+// safe logger begin ++++++++++++++++++++++++++++++++++++++++++++++++++++++
+
+/*
+SafeLogger wraps the injected Logger, it adds request_id from ctx and
+redacts tokens, cookies and passwords before anything reaches the logger.
+All logs of the library go through it.
+*/
+type SafeLogger struct {
+	logger Logger
+}
+
+// logger == nil: drop all logs
+func NewSafeLogger(logger Logger) *SafeLogger {
+	if logger == nil {
+		logger = NopLogger{}
+	}
+	if safe, ok := logger.(*SafeLogger); ok {
+		return safe
+	}
+	return &SafeLogger{logger: logger}
+}
+
+func (l *SafeLogger) Log(ctx context.Context, level Level, msg string, keyvals ...interface{}) {
+	if l == nil {
+		return
+	}
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	kv := make([]interface{}, 0, len(keyvals)+2)
+	if requestId := RequestId(ctx); requestId != "" {
+		kv = append(kv, "request_id", requestId)
+	}
+	for i := 0; i < len(keyvals); i += 2 {
+		key := fmt.Sprint(keyvals[i])
+		if i+1 >= len(keyvals) {
+			kv = append(kv, "!BADKEY", RedactValue(key, keyvals[i]))
+			break
+		}
+		kv = append(kv, key, RedactValue(key, keyvals[i+1]))
+	}
+	l.logger.Log(ctx, level, RedactString(msg), kv...)
+}
+
+func (l *SafeLogger) Debug(ctx context.Context, msg string, keyvals ...interface{}) {
+	l.Log(ctx, LevelDebug, msg, keyvals...)
+}
+
+func (l *SafeLogger) Info(ctx context.Context, msg string, keyvals ...interface{}) {
+	l.Log(ctx, LevelInfo, msg, keyvals...)
+}
+
+func (l *SafeLogger) Warn(ctx context.Context, msg string, keyvals ...interface{}) {
+	l.Log(ctx, LevelWarn, msg, keyvals...)
+}
+
+func (l *SafeLogger) Error(ctx context.Context, msg string, keyvals ...interface{}) {
+	l.Log(ctx, LevelError, msg, keyvals...)
+}
+
+// safe logger end --------------------------------------------------------
+
+// redact begin +++++++++++++++++++++++++++++++++++++++++++++++++++++++++++
+
+const Redacted = "[REDACTED]"
+
+// whole key names, lowercase with - and . as _; usage keys like prompt_tokens are not secrets
+var sensitiveKeys = map[string]bool{
+	"authorization": true, "proxy_authorization": true,
+	"cookie": true, "cookies": true, "set_cookie": true,
+	"password": true, "passwd": true,
+	"token": true, "access_token": true, "accesstoken": true, "refresh_token": true, "id_token": true,
+	"session_token": true, "sessiontoken": true, "csrf_token": true, "csrftoken": true, "auth_token": true,
+	"secret": true, "secret_key": true, "secretkey": true, "client_secret": true,
+	"api_key": true, "apikey": true, "x_api_key": true,
+	"session": true,
+}
+
+var sensitivePatterns = []struct {
+	reg  *regexp.Regexp
+	repl string
+}{
+	{regexp.MustCompile(`(?i)(bearer|basic)\s+[A-Za-z0-9._~+/=-]+`), "${1} " + Redacted},
+	{regexp.MustCompile(`sk-[A-Za-z0-9_-]{8,}`), Redacted},
+	{regexp.MustCompile(`eyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+`), Redacted},
+	{regexp.MustCompile(`(?i)((?:password|passwd|token|secret|api[_-]?key)["']?\s*[=:]\s*["']?)[^&\s"',;]+`), "${1}" + Redacted},
+}
+
+// whether the key name looks like it holds a secret
+func IsSensitiveKey(key string) bool {
+	key = strings.NewReplacer("-", "_", ".", "_").Replace(strings.ToLower(key))
+	return sensitiveKeys[key]
+}
+
+// remove tokens, passwords and proxy credentials from free text
+func RedactString(s string) string {
+	for _, v := range sensitivePatterns {
+		s = v.reg.ReplaceAllString(s, v.repl)
+	}
+	return redactURLUserinfo(s)
+}
+
+var urlUserinfo = regexp.MustCompile(`([a-zA-Z][a-zA-Z0-9+.-]*://)([^/@\s]+)@`)
+
+func redactURLUserinfo(s string) string {
+	return urlUserinfo.ReplaceAllStringFunc(s, func(m string) string {
+		u, err := url.Parse(m + "x")
+		if err != nil || u.User == nil {
+			return urlUserinfo.ReplaceAllString(m, "${1}"+Redacted+"@")
+		}
+		return urlUserinfo.ReplaceAllString(m, "${1}"+u.User.Username()+":"+Redacted+"@")
+	})
+}
+
+// redact a logged value, maps (http.Header etc.) are redacted by their keys
+func RedactValue(key string, value interface{}) interface{} {
+	if IsSensitiveKey(key) {
+		return Redacted
+	}
+	switch v := value.(type) {
+	case nil:
+		return nil
+	case string:
+		return RedactString(v)
+	case error:
+		return RedactString(v.Error())
+	case fmt.Stringer:
+		return RedactString(v.String())
+	case bool, int, int32, int64, uint, uint32, uint64, float32, float64:
+		return v
+	}
+	rv := reflect.ValueOf(value)
+	switch rv.Kind() {
+	case reflect.Map:
+		if rv.Type().Key().Kind() != reflect.String {
+			break
+		}
+		m := make(map[string]interface{}, rv.Len())
+		for _, k := range rv.MapKeys() {
+			m[k.String()] = RedactValue(k.String(), rv.MapIndex(k).Interface())
+		}
+		return m
+	case reflect.Slice, reflect.Array:
+		if rv.Type().Elem().Kind() == reflect.Uint8 {
+			return RedactString(fmt.Sprint(value))
+		}
+		s := make([]interface{}, rv.Len())
+		for i := 0; i < rv.Len(); i++ {
+			s[i] = RedactValue("", rv.Index(i).Interface())
+		}
+		return s
+	case reflect.Ptr, reflect.Struct:
+		return RedactString(fmt.Sprintf("%+v", value))
+	}
+	return value
+}
+
+// redact end -------------------------------------------------------------
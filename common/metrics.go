@@ -0,0 +1,85 @@
+package common
+
+import (
+	"context"
+	"errors"
+	"net"
+	"time"
+	"unicode/utf8"
+)
+
+// backend names used in metrics, traces and answers
+const (
+	BackendChatGPT    = "chatgpt"
+	BackendChatGPTUno = "chatgptuno"
+)
+
+/*
+Metrics receives observability events of Ask and login,
+see PromMetrics for a Prometheus implementation.
+*/
+type Metrics interface {
+	// time from sending the request to the first chunk
+	ObserveFirstToken(backend string, d time.Duration)
+	// a whole answer was received, tokens are estimated when the backend reports none
+	ObserveAnswer(backend string, elapsed time.Duration, chunks, tokens int)
+	// total latency of a request, result: ok or error
+	ObserveLatency(backend, result string, d time.Duration)
+	// errType: canceled, timeout, circuit_open, network, http, api, stream, moderation; status: http status code or 0
+	IncError(backend, errType string, status int)
+	IncRetry(backend string)
+	// method: password or session_token; result: ok or error
+	IncLogin(method, result string)
+}
+
+// drop all metrics
+type NopMetrics struct{}
+
+func (NopMetrics) ObserveFirstToken(backend string, d time.Duration)                       {}
+func (NopMetrics) ObserveAnswer(backend string, elapsed time.Duration, chunks, tokens int) {}
+func (NopMetrics) ObserveLatency(backend, result string, d time.Duration)                  {}
+func (NopMetrics) IncError(backend, errType string, status int)                            {}
+func (NopMetrics) IncRetry(backend string)                                                 {}
+func (NopMetrics) IncLogin(method, result string)                                          {}
+
+// result label of an error
+func MetricResult(err error) string {
+	if err != nil {
+		return "error"
+	}
+	return "ok"
+}
+
+// rough token count of text: 4 ascii chars or 1 other char per token
+func EstimateTokens(text string) int {
+	var ascii, other int
+	for _, r := range text {
+		if r < utf8.RuneSelf {
+			ascii++
+		} else {
+			other++
+		}
+	}
+	return (ascii+3)/4 + other
+}
+
+// generic error type label: canceled, timeout, circuit_open, network or the given fallback
+func ClassifyError(err error, fallback string) string {
+	if errors.Is(err, ErrCircuitOpen) {
+		return "circuit_open"
+	}
+	if errors.Is(err, context.Canceled) {
+		return "canceled"
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return "timeout"
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		if netErr.Timeout() {
+			return "timeout"
+		}
+		return "network"
+	}
+	return fallback
+}
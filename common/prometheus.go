@@ -0,0 +1,244 @@
+package common
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+/*
+PromMetrics keeps metrics in memory and serves them in the Prometheus text exposition format.
+
+	metrics := common.NewPromMetrics()
+	conversation.SetMetrics(metrics)
+	http.Handle("/metrics", metrics)
+	http.ListenAndServe("127.0.0.1:9100", nil)
+*/
+type PromMetrics struct {
+	firstToken   *promHistogram
+	latency      *promHistogram
+	chunks       *promHistogram
+	tokensPerSec *promHistogram
+	errors       *promCounter
+	retries      *promCounter
+	logins       *promCounter
+	sync.Mutex
+}
+
+var (
+	secondBuckets = []float64{0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 120}
+	chunkBuckets  = []float64{1, 5, 10, 50, 100, 250, 500, 1000, 2000}
+	tpsBuckets    = []float64{1, 5, 10, 20, 40, 80, 160, 320}
+)
+
+func NewPromMetrics() *PromMetrics {
+	m := &PromMetrics{
+		firstToken:   newPromHistogram("gochatgpt_first_token_seconds", "Time from sending the request to the first chunk.", secondBuckets, "backend"),
+		latency:      newPromHistogram("gochatgpt_request_duration_seconds", "Total latency of a request.", secondBuckets, "backend", "result"),
+		chunks:       newPromHistogram("gochatgpt_answer_chunks", "Streamed chunks per answer.", chunkBuckets, "backend"),
+		tokensPerSec: newPromHistogram("gochatgpt_tokens_per_second", "Generated tokens per second of an answer.", tpsBuckets, "backend"),
+		errors:       newPromCounter("gochatgpt_errors_total", "Errors by type and http status.", "backend", "type", "status"),
+		retries:      newPromCounter("gochatgpt_retries_total", "Retried requests.", "backend"),
+		logins:       newPromCounter("gochatgpt_login_attempts_total", "Login attempts.", "method", "result"),
+	}
+	return m
+}
+
+func (m *PromMetrics) ObserveFirstToken(backend string, d time.Duration) {
+	m.Lock()
+	defer m.Unlock()
+
+	m.firstToken.observe(d.Seconds(), backend)
+}
+
+func (m *PromMetrics) ObserveAnswer(backend string, elapsed time.Duration, chunks, tokens int) {
+	m.Lock()
+	defer m.Unlock()
+
+	m.chunks.observe(float64(chunks), backend)
+	if elapsed > 0 && tokens > 0 {
+		m.tokensPerSec.observe(float64(tokens)/elapsed.Seconds(), backend)
+	}
+}
+
+func (m *PromMetrics) ObserveLatency(backend, result string, d time.Duration) {
+	m.Lock()
+	defer m.Unlock()
+
+	m.latency.observe(d.Seconds(), backend, result)
+}
+
+func (m *PromMetrics) IncError(backend, errType string, status int) {
+	m.Lock()
+	defer m.Unlock()
+
+	m.errors.inc(backend, errType, strconv.Itoa(status))
+}
+
+func (m *PromMetrics) IncRetry(backend string) {
+	m.Lock()
+	defer m.Unlock()
+
+	m.retries.inc(backend)
+}
+
+func (m *PromMetrics) IncLogin(method, result string) {
+	m.Lock()
+	defer m.Unlock()
+
+	m.logins.inc(method, result)
+}
+
+// write all metrics in the text exposition format
+func (m *PromMetrics) WriteTo(w io.Writer) (int64, error) {
+	m.Lock()
+	defer m.Unlock()
+
+	var b strings.Builder
+	m.firstToken.write(&b)
+	m.latency.write(&b)
+	m.chunks.write(&b)
+	m.tokensPerSec.write(&b)
+	m.errors.write(&b)
+	m.retries.write(&b)
+	m.logins.write(&b)
+	n, err := io.WriteString(w, b.String())
+	return int64(n), err
+}
+
+func (m *PromMetrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	m.WriteTo(w)
+}
+
+// prometheus types begin ++++++++++++++++++++++++++++++++++++++++++++++++
+
+type promCounter struct {
+	name   string
+	help   string
+	labels []string
+	values map[string]float64
+	keys   map[string][]string
+}
+
+func newPromCounter(name, help string, labels ...string) *promCounter {
+	return &promCounter{
+		name:   name,
+		help:   help,
+		labels: labels,
+		values: make(map[string]float64),
+		keys:   make(map[string][]string),
+	}
+}
+
+func (c *promCounter) inc(labelValues ...string) {
+	key := strings.Join(labelValues, "\xff")
+	c.values[key]++
+	c.keys[key] = labelValues
+}
+
+func (c *promCounter) write(b *strings.Builder) {
+	fmt.Fprintf(b, "# HELP %s %s\n# TYPE %s counter\n", c.name, c.help, c.name)
+	for _, key := range sortedKeys(c.keys) {
+		fmt.Fprintf(b, "%s%s %s\n", c.name, promLabels(c.labels, c.keys[key]), promFloat(c.values[key]))
+	}
+}
+
+type promSeries struct {
+	labelValues []string
+	counts      []uint64
+	sum         float64
+	count       uint64
+}
+
+type promHistogram struct {
+	name    string
+	help    string
+	labels  []string
+	buckets []float64
+	series  map[string]*promSeries
+}
+
+func newPromHistogram(name, help string, buckets []float64, labels ...string) *promHistogram {
+	return &promHistogram{
+		name:    name,
+		help:    help,
+		labels:  labels,
+		buckets: buckets,
+		series:  make(map[string]*promSeries),
+	}
+}
+
+func (h *promHistogram) observe(v float64, labelValues ...string) {
+	key := strings.Join(labelValues, "\xff")
+	s := h.series[key]
+	if s == nil {
+		s = &promSeries{labelValues: labelValues, counts: make([]uint64, len(h.buckets))}
+		h.series[key] = s
+	}
+	for i, upper := range h.buckets {
+		if v <= upper {
+			s.counts[i]++
+		}
+	}
+	s.sum += v
+	s.count++
+}
+
+func (h *promHistogram) write(b *strings.Builder) {
+	fmt.Fprintf(b, "# HELP %s %s\n# TYPE %s histogram\n", h.name, h.help, h.name)
+	keys := make([]string, 0, len(h.series))
+	for key := range h.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	bucketLabels := append(append([]string{}, h.labels...), "le")
+	for _, key := range keys {
+		s := h.series[key]
+		for i, upper := range h.buckets {
+			values := append(append([]string{}, s.labelValues...), promFloat(upper))
+			fmt.Fprintf(b, "%s_bucket%s %d\n", h.name, promLabels(bucketLabels, values), s.counts[i])
+		}
+		values := append(append([]string{}, s.labelValues...), "+Inf")
+		fmt.Fprintf(b, "%s_bucket%s %d\n", h.name, promLabels(bucketLabels, values), s.count)
+		fmt.Fprintf(b, "%s_sum%s %s\n", h.name, promLabels(h.labels, s.labelValues), promFloat(s.sum))
+		fmt.Fprintf(b, "%s_count%s %d\n", h.name, promLabels(h.labels, s.labelValues), s.count)
+	}
+}
+
+func sortedKeys(m map[string][]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func promLabels(names, values []string) string {
+	if len(names) == 0 {
+		return ""
+	}
+	pairs := make([]string, len(names))
+	for i, name := range names {
+		pairs[i] = fmt.Sprintf(`%s="%s"`, name, labelEscaper.Replace(values[i]))
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func promFloat(v float64) string {
+	if math.IsInf(v, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// prometheus types end --------------------------------------------------
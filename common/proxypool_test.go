@@ -0,0 +1,162 @@
+package common
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestProxyPoolNext(t *testing.T) {
+	tests := []struct {
+		name     string
+		rotation ProxyRotation
+		accounts []string
+		want     []string
+	}{
+		{"per request", RotatePerRequest, []string{"", "", "", ""}, []string{"http://a:1", "http://b:1", "http://c:1", "http://a:1"}},
+		{"per request ignores accounts", RotatePerRequest, []string{"x", "x"}, []string{"http://a:1", "http://b:1"}},
+		{"per account", RotatePerAccount, []string{"x", "y", "x", "z", "y"}, []string{"http://a:1", "http://b:1", "http://a:1", "http://c:1", "http://b:1"}},
+	}
+	for _, tt := range tests {
+		pool, err := NewProxyPool(ProxyPoolConfig{Rotation: tt.rotation}, "http://a:1", "b:1", "http://c:1", "http://a:1")
+		if err != nil {
+			t.Fatalf("%s: NewProxyPool: %v", tt.name, err)
+		}
+		for i, account := range tt.accounts {
+			got, err := pool.Next(account)
+			if err != nil || got != tt.want[i] {
+				t.Errorf("%s: Next #%d = %q, %v, want %q", tt.name, i, got, err, tt.want[i])
+			}
+		}
+	}
+}
+
+func TestProxyPoolRemove(t *testing.T) {
+	var removed []string
+	pool, err := NewProxyPool(ProxyPoolConfig{
+		Rotation:    RotatePerAccount,
+		MaxFailures: 2,
+		OnRemove: func(proxy string, err error) {
+			removed = append(removed, proxy)
+		},
+	}, "http://user:secret@a:1", "http://b:1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	proxy, _ := pool.Next("x")
+	failed := errors.New("connection refused")
+	pool.Done(proxy, failed)
+	pool.Done(proxy, context.Canceled) // not counted
+	if pool.Len() != 2 {
+		t.Fatalf("removed after one failure")
+	}
+	pool.Done(proxy, failed)
+	if pool.Len() != 1 {
+		t.Fatalf("Len() = %d after %d failures, want 1", pool.Len(), 2)
+	}
+	if len(removed) != 1 || strings.Contains(removed[0], "secret") {
+		t.Errorf("OnRemove got %q, want one redacted proxy", removed)
+	}
+	// the account moves to the next proxy
+	if got, _ := pool.Next("x"); got != "http://b:1" {
+		t.Errorf("Next after removal = %q", got)
+	}
+	pool.Done("http://b:1", failed)
+	pool.Done("http://b:1", failed)
+	if _, err := pool.Next("x"); !errors.Is(err, ErrNoProxy) {
+		t.Errorf("Next of empty pool err = %v, want ErrNoProxy", err)
+	}
+	status := pool.Status()
+	if len(status) != 2 || status[0].Healthy || status[0].Failures != 2 || strings.Contains(status[0].URL, "secret") {
+		t.Errorf("Status = %+v", status)
+	}
+	pool.Remove("http://user:secret@a:1")
+	if len(pool.Status()) != 1 {
+		t.Errorf("Remove kept the proxy")
+	}
+}
+
+func TestProxyPoolCheck(t *testing.T) {
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized) // the endpoint answered, the proxy works
+	}))
+	defer target.Close()
+	proxy := httptest.NewServer(http.HandlerFunc(forward))
+	defer proxy.Close()
+
+	pool, err := NewProxyPool(ProxyPoolConfig{MaxFailures: 1, CheckURL: target.URL}, proxy.URL, "http://127.0.0.1:1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool.Done(proxy.URL, errors.New("timeout"))
+	if pool.Len() != 1 {
+		t.Fatalf("Len() = %d, want 1", pool.Len())
+	}
+	result := pool.Check(context.Background())
+	if len(result) != 2 || result[proxy.URL] != nil || result["http://127.0.0.1:1"] == nil {
+		t.Errorf("Check = %v", result)
+	}
+	// the working proxy is back, the dead one stays out
+	if pool.Len() != 1 {
+		t.Errorf("Len() after Check = %d, want 1", pool.Len())
+	}
+	if got, _ := pool.Next(""); got != proxy.URL {
+		t.Errorf("Next after Check = %q, want %q", got, proxy.URL)
+	}
+}
+
+func TestProxyTransport(t *testing.T) {
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "ok")
+	}))
+	defer target.Close()
+	var proxied int
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied++
+		forward(w, r)
+	}))
+	defer proxy.Close()
+
+	pool, err := NewProxyPool(ProxyPoolConfig{MaxFailures: 1}, "http://127.0.0.1:1", proxy.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := &http.Client{Transport: pool.Transport(nil)}
+	if _, err := client.Get(target.URL); err == nil {
+		t.Fatalf("request through the dead proxy succeeded")
+	}
+	for i := 0; i < 2; i++ {
+		resp, err := client.Get(target.URL)
+		if err != nil {
+			t.Fatalf("request %d: %v", i, err)
+		}
+		b, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if string(b) != "ok" {
+			t.Errorf("body = %q", b)
+		}
+	}
+	if proxied != 2 || pool.Len() != 1 {
+		t.Errorf("proxied %d requests, %d proxies left; want 2 and 1", proxied, pool.Len())
+	}
+}
+
+// a minimal forward proxy for plain http
+func forward(w http.ResponseWriter, r *http.Request) {
+	r.RequestURI = ""
+	resp, err := http.DefaultTransport.RoundTrip(r)
+	if err != nil {
+		w.WriteHeader(http.StatusBadGateway)
+		return
+	}
+	defer resp.Body.Close()
+	for k, v := range resp.Header {
+		w.Header()[k] = v
+	}
+	w.WriteHeader(resp.StatusCode)
+	io.Copy(w, resp.Body)
+}
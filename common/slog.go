@@ -0,0 +1,25 @@
+//go:build go1.21
+
+package common
+
+import (
+	"context"
+	"log/slog"
+)
+
+// adapter for log/slog
+type SlogLogger struct {
+	logger *slog.Logger
+}
+
+// logger == nil: slog.Default()
+func NewSlogLogger(logger *slog.Logger) *SlogLogger {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return &SlogLogger{logger: logger}
+}
+
+func (l *SlogLogger) Log(ctx context.Context, level Level, msg string, keyvals ...interface{}) {
+	l.logger.Log(ctx, slog.Level(level), msg, keyvals...)
+}
@@ -0,0 +1,106 @@
+package common
+
+import (
+	"context"
+	"time"
+)
+
+// span attribute keys
+const (
+	AttrBackend          = "chat.backend"
+	AttrModel            = "chat.model"
+	AttrConversationId   = "chat.conversation_id"
+	AttrMessageId        = "chat.message_id"
+	AttrParentId         = "chat.parent_id"
+	AttrStatus           = "chat.status"
+	AttrHTTPStatus       = "http.status_code"
+	AttrRetryCount       = "chat.retry_count"
+	AttrPromptTokens     = "chat.prompt_tokens"
+	AttrCompletionTokens = "chat.completion_tokens"
+	AttrChunks           = "chat.chunks"
+	AttrCache            = "chat.cache"
+	AttrFinishReason     = "chat.finish_reason"
+)
+
+type Attr struct {
+	Key   string
+	Value interface{} // string, bool, int, int64, float64
+}
+
+func Attribute(key string, value interface{}) Attr {
+	return Attr{Key: key, Value: value}
+}
+
+type Span interface {
+	SetAttributes(attrs ...Attr)
+	RecordError(err error)
+	End()
+}
+
+/*
+Tracer starts spans, it maps 1:1 to OpenTelemetry, see README for an adapter.
+The returned ctx carries the span and is passed to the http requests.
+*/
+type Tracer interface {
+	Start(ctx context.Context, name string, attrs ...Attr) (context.Context, Span)
+}
+
+// no tracing
+type NopTracer struct{}
+
+func (NopTracer) Start(ctx context.Context, name string, attrs ...Attr) (context.Context, Span) {
+	return ctx, nopSpan{}
+}
+
+type nopSpan struct{}
+
+func (nopSpan) SetAttributes(attrs ...Attr) {}
+func (nopSpan) RecordError(err error)       {}
+func (nopSpan) End()                        {}
+
+// record the status and err, then end the span
+func EndSpan(span Span, err error) {
+	if err != nil {
+		span.RecordError(RedactError(err))
+	}
+	span.SetAttributes(Attribute(AttrStatus, MetricResult(err)))
+	span.End()
+}
+
+type redactedError struct {
+	err error
+	msg string
+}
+
+func (e *redactedError) Error() string { return e.msg }
+func (e *redactedError) Unwrap() error { return e.err }
+
+// err with tokens and passwords removed from its message
+func RedactError(err error) error {
+	if err == nil {
+		return nil
+	}
+	msg := RedactString(err.Error())
+	if msg == err.Error() {
+		return err
+	}
+	return &redactedError{err: err, msg: msg}
+}
+
+// detachedContext keeps the values (request id, span) of the parent but is never canceled
+type detachedContext struct {
+	parent context.Context
+}
+
+func (ctx detachedContext) Deadline() (time.Time, bool)       { return time.Time{}, false }
+func (ctx detachedContext) Done() <-chan struct{}             { return nil }
+func (ctx detachedContext) Err() error                        { return nil }
+func (ctx detachedContext) Value(key interface{}) interface{} { return ctx.parent.Value(key) }
+
+// context for background work started by a request, like context.WithoutCancel
+func DetachContext(ctx context.Context) context.Context {
+	if ctx == nil {
+		return context.Background()
+	}
+	return detachedContext{parent: ctx}
+}
@@ -0,0 +1,186 @@
+package failover
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/billikeu/go-chatgpt/archive"
+	"github.com/billikeu/go-chatgpt/chatgpt"
+	"github.com/billikeu/go-chatgpt/chatgptuno"
+	"github.com/billikeu/go-chatgpt/params"
+)
+
+/*
+Backend answers a prompt with the whole conversation so far. history is the canonical
+transcript of the Client, it may have been answered by other backends.
+*/
+type Backend interface {
+	Name() string
+	// callback gets the chunks and a last answer with Done
+	Ask(ctx context.Context, history []*archive.Message, prompt *archive.Message, callback func(answer *params.Answer, err error)) error
+	// nil: the backend can take requests
+	Health(ctx context.Context) error
+}
+
+// which transcript a backend has already seen, its own state can be reused while the transcript only grew by its answers
+type syncState struct {
+	prompt *archive.Message
+	size   int // len(history) of the last Ask
+}
+
+func (s *syncState) inSync(history []*archive.Message) bool {
+	if s.prompt == nil {
+		return len(history) == 0
+	}
+	return len(history) == s.size+2 && history[s.size] == s.prompt
+}
+
+func (s *syncState) done(history []*archive.Message, prompt *archive.Message) {
+	s.prompt = prompt
+	s.size = len(history)
+}
+
+// api backend begin ++++++++++++++++++++++++++++++++++++++++++++++++++++++++
+
+/*
+APIBackend is the official API or a compatible third-party base URL.
+
+	chat := chatgpt.NewChatGPTConversion("sk-...")
+	chat.SetBaseURL("https://api.example.com/v1")
+	chat.Init()
+	backend := failover.NewAPIBackend("example", chat)
+*/
+type APIBackend struct {
+	name  string
+	chat  *chatgpt.ChatGPTConversion
+	state syncState
+	sync.Mutex
+}
+
+func NewAPIBackend(name string, chat *chatgpt.ChatGPTConversion) *APIBackend {
+	return &APIBackend{name: name, chat: chat}
+}
+
+func (b *APIBackend) Name() string {
+	return b.name
+}
+
+func (b *APIBackend) Ask(ctx context.Context, history []*archive.Message, prompt *archive.Message, callback func(answer *params.Answer, err error)) error {
+	b.Lock()
+	defer b.Unlock()
+
+	if !b.state.inSync(history) {
+		// the transcript was continued elsewhere
+		if err := b.chat.SetRequestContext(ctx, (&archive.Conversation{Messages: history}).ToRequest()); err != nil {
+			b.state = syncState{}
+			return err
+		}
+	}
+	parts := []chatgpt.ContentPart{chatgpt.TextPart(prompt.Content)}
+	for _, v := range prompt.Images {
+		parts = append(parts, chatgpt.ImageURLPart(v, ""))
+	}
+	if err := b.chat.AskParts(ctx, parts, callback); err != nil {
+		b.state = syncState{}
+		return err
+	}
+	b.state.done(history, prompt)
+	return nil
+}
+
+func (b *APIBackend) Health(ctx context.Context) error {
+	return b.chat.Ping(ctx)
+}
+
+// api backend end ----------------------------------------------------------
+
+// uno backend begin ++++++++++++++++++++++++++++++++++++++++++++++++++++++++
+
+/*
+UnoBackend is a chatgptuno web backend. A transcript continued by another backend is sent
+as the context of a new web conversation.
+
+	bot := chatgptuno.NewChatGPTUnoBot(&chatgptuno.ChatGPTUnoConfig{AccessToken: "..."})
+	backend := failover.NewUnoBackend("web", bot, "", 360)
+*/
+type UnoBackend struct {
+	name           string
+	bot            *chatgptuno.ChatGPTUnoBot
+	model          string
+	timeout        int
+	conversationId string
+	parentId       string
+	state          syncState
+	sync.Mutex
+}
+
+// model "": the model of the bot config, timeout in seconds
+func NewUnoBackend(name string, bot *chatgptuno.ChatGPTUnoBot, model string, timeout int) *UnoBackend {
+	return &UnoBackend{name: name, bot: bot, model: model, timeout: timeout}
+}
+
+func (b *UnoBackend) Name() string {
+	return b.name
+}
+
+func (b *UnoBackend) Ask(ctx context.Context, history []*archive.Message, prompt *archive.Message, callback func(answer *params.Answer, err error)) error {
+	b.Lock()
+	defer b.Unlock()
+
+	text := prompt.Content
+	if !b.state.inSync(history) {
+		b.conversationId, b.parentId = "", ""
+		text = contextPrompt(history, prompt.Content)
+	}
+	var last *params.Answer
+	err := b.bot.AskAnswer(ctx, text, b.conversationId, b.parentId, b.model, b.timeout, func(answer *params.Answer, err error) {
+		if answer != nil {
+			last = answer
+		}
+		if callback != nil {
+			callback(answer, err)
+		}
+	})
+	if err != nil {
+		b.state = syncState{}
+		return err
+	}
+	if last != nil {
+		b.conversationId, b.parentId = last.ConversationId, last.MsgId
+	}
+	b.state.done(history, prompt)
+	return nil
+}
+
+func (b *UnoBackend) Health(ctx context.Context) error {
+	return b.bot.Ping(ctx)
+}
+
+var roleNames = map[string]string{
+	"system":    "System",
+	"user":      "User",
+	"assistant": "Assistant",
+}
+
+// the transcript and the prompt as the first message of a new conversation
+func contextPrompt(history []*archive.Message, prompt string) string {
+	if len(history) == 0 {
+		return prompt
+	}
+	var sb strings.Builder
+	sb.WriteString("Continue this conversation. The messages so far:\n\n")
+	for _, v := range history {
+		role, ok := roleNames[v.Role]
+		if !ok {
+			role = v.Role
+		}
+		fmt.Fprintf(&sb, "%s: %s\n\n", role, v.Content)
+	}
+	sb.WriteString("Reply to the next user message:\n\n")
+	sb.WriteString(prompt)
+	return sb.String()
+}
+
+// uno backend end ----------------------------------------------------------
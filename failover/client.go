@@ -0,0 +1,278 @@
+package failover
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/billikeu/go-chatgpt/archive"
+	"github.com/billikeu/go-chatgpt/common"
+	"github.com/billikeu/go-chatgpt/moderation"
+	"github.com/billikeu/go-chatgpt/params"
+	openai "github.com/sashabaranov/go-openai"
+	uuid "github.com/satori/go.uuid"
+)
+
+// returned by Ask when the breaker of every backend is open
+var ErrNoBackend = errors.New("no backend available")
+
+type member struct {
+	backend Backend
+	healthy bool
+}
+
+/*
+Client asks the first available backend of an ordered list and fails over to the next one.
+The conversation is kept as one transcript, so the next backend answers with the whole context.
+
+	client := failover.New(
+		failover.NewUnoBackend("web", bot, "", 360),
+		failover.NewAPIBackend("openai", conversation),
+	)
+	client.StartHealthCheck(ctx, time.Minute)
+	err := client.Ask(ctx, "hello", func(answer *params.Answer, err error) {
+		log.Println(answer.Backend, answer.Text)
+	})
+*/
+type Client struct {
+	members    []*member
+	breakers   *common.BreakerGroup // by backend name
+	transcript []*archive.Message
+	logger     *common.SafeLogger
+	metrics    common.Metrics
+	askMu      sync.Mutex // one Ask at a time, the transcript is linear
+	sync.RWMutex
+}
+
+func New(backends ...Backend) *Client {
+	c := &Client{
+		breakers: common.NewBreakerGroup(defaultBreaker),
+		logger:   common.NewSafeLogger(common.NewStdLogger(nil, common.LevelInfo)),
+		metrics:  common.NopMetrics{},
+	}
+	for _, v := range backends {
+		c.members = append(c.members, &member{backend: v, healthy: true})
+	}
+	return c
+}
+
+// set logger, nil: standard log at info level
+func (c *Client) SetLogger(logger common.Logger) {
+	if logger == nil {
+		logger = common.NewStdLogger(nil, common.LevelInfo)
+	}
+	c.logger = common.NewSafeLogger(logger)
+}
+
+// set metrics hook, every failover counts as a retry of the failed backend
+func (c *Client) SetMetrics(metrics common.Metrics) {
+	if metrics == nil {
+		metrics = common.NopMetrics{}
+	}
+	c.metrics = metrics
+}
+
+var defaultBreaker = common.BreakerConfig{FailureThreshold: 3, OpenTimeout: 30 * time.Second}
+
+// set the breaker of every backend, a backend is skipped while its breaker is open, default 3 failures and 30s
+func (c *Client) SetBreaker(cfg common.BreakerConfig) {
+	c.Lock()
+	defer c.Unlock()
+
+	c.breakers = common.NewBreakerGroup(cfg)
+}
+
+func (c *Client) breaker(m *member) *common.Breaker {
+	c.RLock()
+	defer c.RUnlock()
+
+	return c.breakers.Get(m.backend.Name())
+}
+
+// set the system message of the transcript
+func (c *Client) SetSystemMsg(content string) {
+	c.Lock()
+	defer c.Unlock()
+
+	msg := &archive.Message{ID: uuid.NewV4().String(), Role: openai.ChatMessageRoleSystem, Content: content, CreateTime: time.Now()}
+	if len(c.transcript) > 0 && c.transcript[0].Role == openai.ChatMessageRoleSystem {
+		c.transcript = append([]*archive.Message{msg}, c.transcript[1:]...)
+		return
+	}
+	c.transcript = append([]*archive.Message{msg}, c.transcript...)
+}
+
+// the canonical transcript of the conversation
+func (c *Client) Transcript() []*archive.Message {
+	c.RLock()
+	defer c.RUnlock()
+
+	return append([]*archive.Message(nil), c.transcript...)
+}
+
+// continue from another transcript, like an imported archive.Conversation
+func (c *Client) SetTranscript(messages []*archive.Message) {
+	c.askMu.Lock()
+	defer c.askMu.Unlock()
+	c.Lock()
+	defer c.Unlock()
+
+	c.transcript = append([]*archive.Message(nil), messages...)
+}
+
+// backends to try: healthy ones first, in order
+func (c *Client) candidates() []*member {
+	c.RLock()
+	defer c.RUnlock()
+
+	var healthy, unhealthy []*member
+	for _, v := range c.members {
+		if v.healthy {
+			healthy = append(healthy, v)
+		} else {
+			unhealthy = append(unhealthy, v)
+		}
+	}
+	return append(healthy, unhealthy...)
+}
+
+/*
+Ask the first available backend, on an error the next one is asked with the same transcript.
+Chunks of a failed backend may already have been sent, the first answer of the next one has Reset
+set: replace what was shown with its Chunk. Its ChunkIndex starts again with 1.
+A prompt blocked by moderation and a done ctx are not failed over.
+*/
+func (c *Client) Ask(ctx context.Context, prompt string, callback func(answer *params.Answer, err error)) (err error) {
+	defer func() {
+		if callback != nil && err != nil {
+			callback(nil, err)
+		}
+	}()
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	ctx = common.EnsureRequestId(ctx)
+	c.askMu.Lock()
+	defer c.askMu.Unlock()
+
+	history := c.Transcript()
+	msg := &archive.Message{ID: uuid.NewV4().String(), Role: openai.ChatMessageRoleUser, Content: prompt, CreateTime: time.Now()}
+	var lastErr error
+	tried := 0
+	for _, m := range c.candidates() {
+		name := m.backend.Name()
+		breaker := c.breaker(m)
+		if breaker.Allow() != nil {
+			continue
+		}
+		// the caller may have chunks of a failed backend
+		reset := tried > 0
+		tried++
+		var final *params.Answer
+		err = m.backend.Ask(ctx, history, msg, func(answer *params.Answer, err error) {
+			// errors are handled after Ask returns
+			if answer == nil || err != nil {
+				return
+			}
+			if reset {
+				answer.Reset = true
+				answer.Chunk = answer.Text
+				reset = false
+			}
+			if answer.Done {
+				final = answer
+			}
+			if callback != nil {
+				callback(answer, nil)
+			}
+		})
+		if err == nil && final == nil {
+			err = fmt.Errorf("backend %s sent no answer", name)
+		}
+		if err == nil {
+			breaker.Done(nil, 0)
+			c.commit(msg, final)
+			return nil
+		}
+		if errors.Is(err, moderation.ErrBlocked) {
+			breaker.Done(nil, 0)
+			return err
+		}
+		if ctx.Err() != nil {
+			// the caller gave up, no verdict on the backend
+			breaker.Done(context.Canceled, 0)
+			return err
+		}
+		breaker.Done(err, 0)
+		c.metrics.IncRetry(name)
+		c.logger.Warn(ctx, "backend failed", "backend", name, "err", err.Error())
+		lastErr = err
+	}
+	if lastErr == nil {
+		return ErrNoBackend
+	}
+	return fmt.Errorf("all backends failed, last err:%s", lastErr.Error())
+}
+
+func (c *Client) commit(prompt *archive.Message, answer *params.Answer) {
+	c.Lock()
+	defer c.Unlock()
+
+	c.transcript = append(c.transcript, prompt, &archive.Message{
+		ID:           uuid.NewV4().String(),
+		Role:         openai.ChatMessageRoleAssistant,
+		Content:      answer.Text,
+		Model:        answer.Model,
+		FinishReason: answer.FinishReason,
+		Truncated:    answer.FinishReason == params.FinishReasonStopped,
+		CreateTime:   time.Now(),
+	})
+}
+
+// health check begin +++++++++++++++++++++++++++++++++++++++++++++++++++++++
+
+// check every backend now, return the errors by backend name
+func (c *Client) CheckHealth(ctx context.Context) map[string]error {
+	c.RLock()
+	members := append([]*member(nil), c.members...)
+	c.RUnlock()
+
+	result := make(map[string]error, len(members))
+	for _, m := range members {
+		err := m.backend.Health(ctx)
+		result[m.backend.Name()] = err
+		c.Lock()
+		changed := m.healthy != (err == nil)
+		m.healthy = err == nil
+		c.Unlock()
+		if changed && err != nil {
+			c.logger.Warn(ctx, "backend unhealthy", "backend", m.backend.Name(), "err", err.Error())
+		} else if changed {
+			c.logger.Info(ctx, "backend healthy", "backend", m.backend.Name())
+		}
+	}
+	return result
+}
+
+// check the backends every interval until ctx is done, unhealthy backends are tried last
+func (c *Client) StartHealthCheck(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		interval = time.Minute
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			c.CheckHealth(ctx)
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// health check end ---------------------------------------------------------
@@ -0,0 +1,222 @@
+package failover
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/billikeu/go-chatgpt/archive"
+	"github.com/billikeu/go-chatgpt/common"
+	"github.com/billikeu/go-chatgpt/moderation"
+	"github.com/billikeu/go-chatgpt/params"
+)
+
+// a backend answering with reply or failing with err, after streaming partial
+type fakeBackend struct {
+	name    string
+	reply   string
+	partial string
+	err     error
+	health  error
+	asked   int
+	history []*archive.Message
+}
+
+func (b *fakeBackend) Name() string {
+	return b.name
+}
+
+func (b *fakeBackend) Ask(ctx context.Context, history []*archive.Message, prompt *archive.Message, callback func(answer *params.Answer, err error)) error {
+	b.asked++
+	b.history = history
+	if b.partial != "" {
+		callback(params.NewAnswer("m", "", b.partial, b.partial, false, 1), nil)
+	}
+	if b.err != nil {
+		return b.err
+	}
+	callback(params.NewAnswer("m", "", b.reply, b.reply, false, 1), nil)
+	answer := params.NewAnswer("m", "", "", b.reply, true, 2)
+	answer.Model = b.name + "-model"
+	answer.FinishReason = "stop"
+	callback(answer, nil)
+	return nil
+}
+
+func (b *fakeBackend) Health(ctx context.Context) error {
+	return b.health
+}
+
+func quietClient(backends ...Backend) *Client {
+	c := New(backends...)
+	c.SetLogger(common.NopLogger{})
+	return c
+}
+
+func TestClientFailover(t *testing.T) {
+	web := &fakeBackend{name: "web", err: errors.New("502 bad gateway")}
+	api := &fakeBackend{name: "api", reply: "hi"}
+	c := quietClient(web, api)
+	c.SetSystemMsg("be brief")
+
+	var texts []string
+	err := c.Ask(context.Background(), "hello", func(answer *params.Answer, err error) {
+		if answer != nil && answer.Done {
+			texts = append(texts, answer.Text)
+		}
+	})
+	if err != nil || len(texts) != 1 || texts[0] != "hi" {
+		t.Fatalf("Ask = %v, answers %q", err, texts)
+	}
+	if web.asked != 1 || api.asked != 1 || len(api.history) != 1 {
+		t.Errorf("asked web %d, api %d with %d messages", web.asked, api.asked, len(api.history))
+	}
+	transcript := c.Transcript()
+	if len(transcript) != 3 || transcript[1].Content != "hello" || transcript[2].Content != "hi" || transcript[2].Model != "api-model" {
+		t.Errorf("transcript = %+v", transcript)
+	}
+
+	// the next backend gets the whole transcript
+	web.err = nil
+	web.reply = "again"
+	if err := c.Ask(context.Background(), "more", nil); err != nil {
+		t.Fatal(err)
+	}
+	if len(web.history) != 3 || len(c.Transcript()) != 5 {
+		t.Errorf("web saw %d messages, transcript has %d", len(web.history), len(c.Transcript()))
+	}
+}
+
+func TestClientFailoverAfterChunks(t *testing.T) {
+	web := &fakeBackend{name: "web", partial: "Hel", err: errors.New("stream broken")}
+	api := &fakeBackend{name: "api", reply: "Hi"}
+	c := quietClient(web, api)
+
+	var shown string
+	var answers []*params.Answer
+	err := c.Ask(context.Background(), "hello", func(answer *params.Answer, err error) {
+		if answer == nil {
+			return
+		}
+		answers = append(answers, answer)
+		if answer.Reset {
+			shown = answer.Chunk
+		} else {
+			shown += answer.Chunk
+		}
+	})
+	if err != nil || len(answers) != 3 {
+		t.Fatalf("Ask = %v, %d answers", err, len(answers))
+	}
+	if answers[0].Reset || !answers[1].Reset || answers[1].ChunkIndex != 1 || answers[2].Reset {
+		t.Errorf("Reset of the answers = %v %v %v", answers[0].Reset, answers[1].Reset, answers[2].Reset)
+	}
+	// the chunks of web are replaced
+	if shown != "Hi" || answers[2].Text != "Hi" {
+		t.Errorf("shown %q, answer %q", shown, answers[2].Text)
+	}
+	if transcript := c.Transcript(); len(transcript) != 2 || transcript[1].Content != "Hi" {
+		t.Errorf("transcript = %+v", transcript)
+	}
+}
+
+func TestClientErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		errs    []error
+		want    error // matched by errors.Is, nil: any error
+		asked   []int
+		message string
+	}{
+		{"all failed", []error{errors.New("a down"), errors.New("b down")}, nil, []int{1, 1}, "all backends failed, last err:b down"},
+		{"blocked", []error{&moderation.BlockedError{Result: &params.ModerationResult{Stage: "prompt", Source: "rules"}}, nil}, moderation.ErrBlocked, []int{1, 0}, ""},
+	}
+	for _, tt := range tests {
+		var backends []Backend
+		var fakes []*fakeBackend
+		for i, err := range tt.errs {
+			b := &fakeBackend{name: string(rune('a' + i)), reply: "ok", err: err}
+			backends = append(backends, b)
+			fakes = append(fakes, b)
+		}
+		c := quietClient(backends...)
+		var callbackErr error
+		err := c.Ask(context.Background(), "hello", func(answer *params.Answer, err error) {
+			if err != nil {
+				callbackErr = err
+			}
+		})
+		if err == nil || callbackErr != err {
+			t.Errorf("%s: Ask = %v, callback got %v", tt.name, err, callbackErr)
+			continue
+		}
+		if tt.want != nil && !errors.Is(err, tt.want) {
+			t.Errorf("%s: err = %v, want %v", tt.name, err, tt.want)
+		}
+		if tt.message != "" && err.Error() != tt.message {
+			t.Errorf("%s: err = %q, want %q", tt.name, err.Error(), tt.message)
+		}
+		for i, b := range fakes {
+			if b.asked != tt.asked[i] {
+				t.Errorf("%s: backend %s asked %d times, want %d", tt.name, b.name, b.asked, tt.asked[i])
+			}
+		}
+		if len(c.Transcript()) != 0 {
+			t.Errorf("%s: failed Ask changed the transcript", tt.name)
+		}
+	}
+}
+
+func TestClientBreakerAndHealth(t *testing.T) {
+	web := &fakeBackend{name: "web", err: errors.New("down")}
+	api := &fakeBackend{name: "api", reply: "ok"}
+	c := quietClient(web, api)
+	c.SetBreaker(common.BreakerConfig{FailureThreshold: 1, OpenTimeout: time.Hour})
+
+	for i := 0; i < 2; i++ {
+		if err := c.Ask(context.Background(), "hello", nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// the open breaker skips web
+	if web.asked != 1 || api.asked != 2 {
+		t.Errorf("asked web %d, api %d", web.asked, api.asked)
+	}
+
+	api.err = errors.New("down too")
+	if err := c.Ask(context.Background(), "hello", nil); err == nil || !strings.Contains(err.Error(), "down too") {
+		t.Errorf("Ask = %v", err)
+	}
+	if err := c.Ask(context.Background(), "hello", nil); !errors.Is(err, ErrNoBackend) {
+		t.Errorf("Ask with all breakers open = %v, want ErrNoBackend", err)
+	}
+
+	c = quietClient(web, api)
+	web.health = errors.New("unhealthy")
+	result := c.CheckHealth(context.Background())
+	if result["web"] == nil || result["api"] != nil {
+		t.Errorf("CheckHealth = %v", result)
+	}
+	if m := c.candidates(); m[0].backend != api || m[1].backend != web {
+		t.Errorf("unhealthy backend is not tried last")
+	}
+}
+
+func TestContextPrompt(t *testing.T) {
+	if got := contextPrompt(nil, "hello"); got != "hello" {
+		t.Errorf("contextPrompt without history = %q", got)
+	}
+	history := []*archive.Message{
+		{Role: "system", Content: "be brief"},
+		{Role: "user", Content: "hi"},
+		{Role: "assistant", Content: "hello"},
+	}
+	got := contextPrompt(history, "how are you?")
+	for _, want := range []string{"System: be brief\n\n", "User: hi\n\n", "Assistant: hello\n\n", "how are you?"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("contextPrompt lacks %q:\n%s", want, got)
+		}
+	}
+}
@@ -5,7 +5,7 @@ go 1.19
 require (
 	github.com/bogdanfinn/fhttp v0.5.20
 	github.com/bogdanfinn/tls-client v1.3.9
-	github.com/sashabaranov/go-openai v1.8.0
+	github.com/sashabaranov/go-openai v1.24.1
 	github.com/satori/go.uuid v1.2.0
 	github.com/tidwall/gjson v1.14.4
 	golang.org/x/net v0.1.0
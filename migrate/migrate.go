@@ -0,0 +1,113 @@
+package migrate
+
+import (
+	"context"
+	"errors"
+
+	"github.com/billikeu/go-chatgpt/archive"
+	"github.com/billikeu/go-chatgpt/chatgpt"
+	"github.com/billikeu/go-chatgpt/chatgptuno"
+	"github.com/billikeu/go-chatgpt/common"
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// api models of the model slugs of the web backend
+var models = map[string]string{
+	"text-davinci-002-render":      openai.GPT3Dot5Turbo,
+	"text-davinci-002-render-sha":  openai.GPT3Dot5Turbo,
+	"text-davinci-002-render-paid": openai.GPT3Dot5Turbo,
+	"gpt-4":                        openai.GPT4,
+	"gpt-4-turbo":                  openai.GPT4Turbo,
+	"gpt-4o":                       openai.GPT4o,
+	"gpt-4o-mini":                  "gpt-4o-mini",
+}
+
+// the api model of a web backend model slug, empty when unknown
+func Model(slug string) string {
+	return models[slug]
+}
+
+type Options struct {
+	// system message when the conversation has none
+	SystemMsg string
+	// keep the most recent messages within the estimated tokens, 0: all.
+	// The system message is always kept.
+	MaxTokens int
+	// set the model of the conversation from the model slug of the last answer
+	KeepModel bool
+}
+
+/*
+FromUno continues a chatgptuno conversation with the API: it fetches the conversation,
+walks its current branch and replaces the history of chat with it.
+
+	conv, err := migrate.FromUno(ctx, bot, conversationId, conversation, &migrate.Options{MaxTokens: 3000, KeepModel: true})
+	conversation.Ask(ctx, "go on", callback)
+*/
+func FromUno(ctx context.Context, bot *chatgptuno.ChatGPTUnoBot, conversationId string, chat *chatgpt.ChatGPTConversion, opts *Options) (*archive.Conversation, error) {
+	if conversationId == "" {
+		return nil, errors.New("conversation id is empty")
+	}
+	tree, err := bot.GetConversation(ctx, conversationId)
+	if err != nil {
+		return nil, err
+	}
+	conv := archive.FromUnoTree(tree)
+	if opts == nil {
+		opts = &Options{}
+	}
+	if err := Seed(chat, conv, opts); err != nil {
+		return nil, err
+	}
+	return conv, nil
+}
+
+// replace the history of chat with conv, see FromUno
+func Seed(chat *chatgpt.ChatGPTConversion, conv *archive.Conversation, opts *Options) error {
+	if opts == nil {
+		opts = &Options{}
+	}
+	if len(conv.Messages) == 0 {
+		return errors.New("conversation has no messages")
+	}
+	seeded := &archive.Conversation{ID: conv.ID, Title: conv.Title, CreateTime: conv.CreateTime, UpdateTime: conv.UpdateTime}
+	messages := conv.Messages
+	if messages[0].Role == openai.ChatMessageRoleSystem {
+		seeded.Messages = append(seeded.Messages, messages[0])
+		messages = messages[1:]
+	} else if opts.SystemMsg != "" {
+		seeded.Add(&archive.Message{Role: openai.ChatMessageRoleSystem, Content: opts.SystemMsg})
+	}
+	seeded.Messages = append(seeded.Messages, recent(messages, opts.MaxTokens)...)
+	chat.SetRequest(seeded.ToRequest())
+
+	if opts.KeepModel {
+		for i := len(conv.Messages) - 1; i >= 0; i-- {
+			if v := conv.Messages[i]; v.Role == openai.ChatMessageRoleAssistant && v.Model != "" {
+				chat.SetModel(Model(v.Model))
+				break
+			}
+		}
+	}
+	return nil
+}
+
+// the most recent messages within maxTokens, starting with a user message
+func recent(messages []*archive.Message, maxTokens int) []*archive.Message {
+	if maxTokens <= 0 {
+		return messages
+	}
+	from, tokens := len(messages), 0
+	for i := len(messages) - 1; i >= 0; i-- {
+		tokens += common.EstimateTokens(messages[i].Content)
+		if tokens > maxTokens {
+			break
+		}
+		from = i
+	}
+	// do not start with an answer without its prompt
+	for from < len(messages) && messages[from].Role == openai.ChatMessageRoleAssistant {
+		from++
+	}
+	return messages[from:]
+}
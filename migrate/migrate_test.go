@@ -0,0 +1,70 @@
+package migrate
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/billikeu/go-chatgpt/archive"
+	"github.com/billikeu/go-chatgpt/chatgpt"
+)
+
+func messages(roles ...string) []*archive.Message {
+	var out []*archive.Message
+	for i, role := range roles {
+		// 8 estimated tokens each
+		out = append(out, &archive.Message{ID: string(rune('a' + i)), Role: role, Content: strings.Repeat("x", 32)})
+	}
+	return out
+}
+
+func TestRecent(t *testing.T) {
+	tests := []struct {
+		name      string
+		roles     []string
+		maxTokens int
+		wantFrom  int
+	}{
+		{"all", []string{"user", "assistant", "user", "assistant"}, 0, 0},
+		{"fits", []string{"user", "assistant", "user", "assistant"}, 100, 0},
+		{"last turn", []string{"user", "assistant", "user", "assistant"}, 16, 2},
+		{"skip an answer without prompt", []string{"user", "assistant", "user", "assistant"}, 24, 2},
+		{"nothing fits", []string{"user", "assistant"}, 4, 2},
+	}
+	for _, tt := range tests {
+		msgs := messages(tt.roles...)
+		got := recent(msgs, tt.maxTokens)
+		if len(got) != len(msgs)-tt.wantFrom || (len(got) > 0 && got[0] != msgs[tt.wantFrom]) {
+			t.Errorf("%s: recent kept %d messages, want from %d", tt.name, len(got), tt.wantFrom)
+		}
+	}
+}
+
+func TestModel(t *testing.T) {
+	if Model("text-davinci-002-render-sha") != "gpt-3.5-turbo" || Model("gpt-4o") != "gpt-4o" || Model("unknown") != "" {
+		t.Errorf("Model mapping")
+	}
+}
+
+func TestSeed(t *testing.T) {
+	chat := chatgpt.NewChatGPTConversion("sk-test")
+	conv := archive.NewConversation("web chat")
+	if err := Seed(chat, conv, nil); err == nil {
+		t.Errorf("Seed of an empty conversation succeeded")
+	}
+	conv.Messages = messages("user", "assistant", "user", "assistant")
+	conv.Messages[3].Model = "gpt-4o"
+	if err := Seed(chat, conv, &Options{SystemMsg: "be brief", MaxTokens: 16, KeepModel: true}); err != nil {
+		t.Fatal(err)
+	}
+	req := chat.Request()
+	if sys := req.SystemMsg(); sys == nil || sys.Request().Content != "be brief" {
+		t.Errorf("system message = %+v", sys)
+	}
+	if msgs := req.Msgs(); len(msgs) != 1 || msgs[0].Request().Role != "user" || msgs[0].Answer() != conv.Messages[3].Content || msgs[0].Model() != "gpt-4o" {
+		t.Errorf("seeded %d turns", len(msgs))
+	}
+	// the conversation itself is not changed
+	if len(conv.Messages) != 4 {
+		t.Errorf("Seed changed the conversation")
+	}
+}
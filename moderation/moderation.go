@@ -0,0 +1,140 @@
+package moderation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/billikeu/go-chatgpt/params"
+)
+
+// what to do with a flagged text, the most severe action wins
+type Action int
+
+const (
+	ActionAllow Action = iota
+	ActionFlag
+	ActionRedact
+	ActionBlock
+)
+
+func (a Action) String() string {
+	switch a {
+	case ActionFlag:
+		return "flag"
+	case ActionRedact:
+		return "redact"
+	case ActionBlock:
+		return "block"
+	default:
+		return "allow"
+	}
+}
+
+func ParseAction(action string) Action {
+	switch action {
+	case "flag":
+		return ActionFlag
+	case "redact":
+		return ActionRedact
+	case "block":
+		return ActionBlock
+	default:
+		return ActionAllow
+	}
+}
+
+// stages of a chat
+const (
+	StagePrompt = "prompt"
+	StageOutput = "output"
+)
+
+/*
+Moderator checks a text, the returned result is never nil when err is nil.
+Result.Text holds the text to use, it differs from text only when the action is redact.
+*/
+type Moderator interface {
+	Check(ctx context.Context, text string) (*params.ModerationResult, error)
+}
+
+var ErrBlocked = errors.New("blocked by moderation")
+
+// returned by Ask when a prompt or answer is blocked, errors.Is(err, ErrBlocked) is true
+type BlockedError struct {
+	Result *params.ModerationResult
+}
+
+func (e *BlockedError) Error() string {
+	return fmt.Sprintf("%s %s by %s: %s", e.Result.Stage, ErrBlocked.Error(), e.Result.Source, strings.Join(e.Result.Categories, ", "))
+}
+
+func (e *BlockedError) Is(target error) bool {
+	return target == ErrBlocked
+}
+
+// run moderator on text for stage, return BlockedError when the action is block
+func Run(ctx context.Context, moderator Moderator, stage, text string) (*params.ModerationResult, error) {
+	res, err := moderator.Check(ctx, text)
+	if err != nil {
+		return nil, fmt.Errorf("moderation %s err:%s", stage, err.Error())
+	}
+	res.Stage = stage
+	if res.Text == "" && ParseAction(res.Action) != ActionRedact {
+		res.Text = text
+	}
+	if ParseAction(res.Action) == ActionBlock {
+		return res, &BlockedError{Result: res}
+	}
+	return res, nil
+}
+
+func newResult(source, text string) *params.ModerationResult {
+	return &params.ModerationResult{
+		Source: source,
+		Action: ActionAllow.String(),
+		Text:   text,
+	}
+}
+
+// chain begin ++++++++++++++++++++++++++++++++++++++++++++++++++++++++++
+
+type chain []Moderator
+
+/*
+Chain runs moderators in order, each one checks the text redacted by the previous ones.
+It stops at the first block.
+
+	moderation.Chain(rules, moderation.NewOpenAIModerator(conversation, moderation.ActionBlock))
+*/
+func Chain(moderators ...Moderator) Moderator {
+	return chain(moderators)
+}
+
+func (c chain) Check(ctx context.Context, text string) (*params.ModerationResult, error) {
+	merged := newResult("", text)
+	var sources []string
+	for _, moderator := range c {
+		res, err := moderator.Check(ctx, merged.Text)
+		if err != nil {
+			return nil, err
+		}
+		sources = append(sources, res.Source)
+		merged.Flagged = merged.Flagged || res.Flagged
+		merged.Categories = append(merged.Categories, res.Categories...)
+		if ParseAction(res.Action) > ParseAction(merged.Action) {
+			merged.Action = res.Action
+		}
+		if ParseAction(res.Action) == ActionRedact || res.Text != "" {
+			merged.Text = res.Text
+		}
+		if ParseAction(res.Action) == ActionBlock {
+			break
+		}
+	}
+	merged.Source = strings.Join(sources, ",")
+	return merged, nil
+}
+
+// chain end ------------------------------------------------------------
@@ -0,0 +1,78 @@
+package moderation
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"regexp"
+	"testing"
+)
+
+func TestRuleEngine(t *testing.T) {
+	engine := NewRuleEngine(
+		Rule{Name: "insult", Keywords: []string{"idiot", " "}, Action: ActionFlag},
+		Rule{Name: "card", Pattern: regexp.MustCompile(`\b\d{4}-\d{4}-\d{4}-\d{4}\b`), Action: ActionRedact},
+		Rule{Name: "weapon", Keywords: []string{"bomb"}, Action: ActionBlock},
+	)
+	tests := []struct {
+		text       string
+		action     string
+		categories []string
+		out        string
+	}{
+		{"hello there", "allow", nil, "hello there"},
+		{"you IDIOT", "flag", []string{"insult"}, "you IDIOT"},
+		{"idiots are fine", "allow", nil, "idiots are fine"}, // whole words only
+		{"card 1234-5678-9012-3456 ok", "redact", []string{"card"}, "card [redacted] ok"},
+		{"idiot, my card is 1234-5678-9012-3456", "redact", []string{"insult", "card"}, "idiot, my card is [redacted]"},
+		{"a bomb and 1234-5678-9012-3456", "block", []string{"card", "weapon"}, "a bomb and [redacted]"},
+	}
+	for _, tt := range tests {
+		res, err := engine.Check(context.Background(), tt.text)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.Action != tt.action || !reflect.DeepEqual(res.Categories, tt.categories) || res.Text != tt.out || res.Flagged != (tt.categories != nil) {
+			t.Errorf("Check(%q) = %+v, want %s %v %q", tt.text, res, tt.action, tt.categories, tt.out)
+		}
+	}
+}
+
+func TestRunAndChain(t *testing.T) {
+	redact := NewRuleEngine(Rule{Name: "name", Keywords: []string{"alice"}, Action: ActionRedact})
+	redact.SetReplacement("<name>")
+	block := NewRuleEngine(Rule{Name: "secret", Keywords: []string{"password"}, Action: ActionBlock})
+	flag := NewRuleEngine(Rule{Name: "redacted", Pattern: regexp.MustCompile(`<name>`), Action: ActionFlag})
+	moderator := Chain(redact, block)
+
+	res, err := Run(context.Background(), moderator, StagePrompt, "ask Alice")
+	if err != nil || res.Text != "ask <name>" || res.Action != "redact" || res.Stage != StagePrompt || res.Source != "rules,rules" {
+		t.Errorf("Run = %+v, %v", res, err)
+	}
+
+	res, err = Run(context.Background(), moderator, StageOutput, "alice, the password is 123")
+	var blocked *BlockedError
+	if !errors.Is(err, ErrBlocked) || !errors.As(err, &blocked) || blocked.Result != res {
+		t.Fatalf("Run of a blocked text err = %v", err)
+	}
+	if res.Action != "block" || !reflect.DeepEqual(res.Categories, []string{"name", "secret"}) || res.Stage != StageOutput {
+		t.Errorf("blocked result = %+v", res)
+	}
+
+	// the second moderator checks the redacted text
+	res, _ = Chain(redact, flag).Check(context.Background(), "alice")
+	if res.Action != "redact" || !reflect.DeepEqual(res.Categories, []string{"name", "redacted"}) {
+		t.Errorf("chain saw the unredacted text: %+v", res)
+	}
+}
+
+func TestParseAction(t *testing.T) {
+	for _, action := range []Action{ActionAllow, ActionFlag, ActionRedact, ActionBlock} {
+		if got := ParseAction(action.String()); got != action {
+			t.Errorf("ParseAction(%s) = %s", action, got)
+		}
+	}
+	if ParseAction("unknown") != ActionAllow {
+		t.Errorf("unknown action is not allow")
+	}
+}
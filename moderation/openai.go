@@ -0,0 +1,87 @@
+package moderation
+
+import (
+	"context"
+	"errors"
+
+	"github.com/billikeu/go-chatgpt/params"
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// implemented by *openai.Client and *chatgpt.ChatGPTConversion
+type ModerationClient interface {
+	Moderations(ctx context.Context, request openai.ModerationRequest) (openai.ModerationResponse, error)
+}
+
+// client of the OpenAI moderation endpoint
+type OpenAIModerator struct {
+	client      ModerationClient
+	action      Action
+	threshold   float32
+	replacement string
+}
+
+// action is applied to flagged texts, redact replaces the whole text
+func NewOpenAIModerator(client ModerationClient, action Action) *OpenAIModerator {
+	return &OpenAIModerator{
+		client:      client,
+		action:      action,
+		replacement: "[removed by moderation]",
+	}
+}
+
+// flag categories whose score >= threshold, default 0: use the flags of the endpoint
+func (m *OpenAIModerator) SetThreshold(threshold float32) {
+	m.threshold = threshold
+}
+
+func (m *OpenAIModerator) Check(ctx context.Context, text string) (*params.ModerationResult, error) {
+	res := newResult("openai", text)
+	if text == "" {
+		return res, nil
+	}
+	resp, err := m.client.Moderations(ctx, openai.ModerationRequest{Input: text})
+	if err != nil {
+		return nil, err
+	}
+	if len(resp.Results) == 0 {
+		return nil, errors.New("empty moderation results")
+	}
+	for _, v := range resp.Results {
+		for _, category := range categories(v) {
+			if (m.threshold > 0 && category.score >= m.threshold) || (m.threshold <= 0 && category.flagged) {
+				res.Categories = append(res.Categories, category.name)
+			}
+		}
+		if m.threshold <= 0 && v.Flagged && len(res.Categories) == 0 {
+			res.Categories = append(res.Categories, "flagged")
+		}
+	}
+	if len(res.Categories) == 0 {
+		return res, nil
+	}
+	res.Flagged = true
+	res.Action = m.action.String()
+	if m.action == ActionRedact {
+		res.Text = m.replacement
+	}
+	return res, nil
+}
+
+type category struct {
+	name    string
+	flagged bool
+	score   float32
+}
+
+func categories(v openai.Result) []category {
+	return []category{
+		{"hate", v.Categories.Hate, v.CategoryScores.Hate},
+		{"hate/threatening", v.Categories.HateThreatening, v.CategoryScores.HateThreatening},
+		{"self-harm", v.Categories.SelfHarm, v.CategoryScores.SelfHarm},
+		{"sexual", v.Categories.Sexual, v.CategoryScores.Sexual},
+		{"sexual/minors", v.Categories.SexualMinors, v.CategoryScores.SexualMinors},
+		{"violence", v.Categories.Violence, v.CategoryScores.Violence},
+		{"violence/graphic", v.Categories.ViolenceGraphic, v.CategoryScores.ViolenceGraphic},
+	}
+}
@@ -0,0 +1,87 @@
+package moderation
+
+import (
+	"context"
+	"regexp"
+	"strings"
+
+	"github.com/billikeu/go-chatgpt/params"
+)
+
+// a local rule, it matches when any keyword (case insensitive, whole word) or the pattern matches
+type Rule struct {
+	Name     string
+	Keywords []string
+	Pattern  *regexp.Regexp
+	Action   Action
+}
+
+type compiledRule struct {
+	Rule
+	reg []*regexp.Regexp
+}
+
+// keyword and regexp rule engine, it is cheap enough to run on every streamed chunk
+type RuleEngine struct {
+	rules       []compiledRule
+	replacement string
+}
+
+func NewRuleEngine(rules ...Rule) *RuleEngine {
+	engine := &RuleEngine{replacement: "[redacted]"}
+	for _, rule := range rules {
+		engine.AddRule(rule)
+	}
+	return engine
+}
+
+// text replacing matches of redact rules, default: [redacted]
+func (engine *RuleEngine) SetReplacement(replacement string) {
+	engine.replacement = replacement
+}
+
+func (engine *RuleEngine) AddRule(rule Rule) {
+	compiled := compiledRule{Rule: rule}
+	if len(rule.Keywords) > 0 {
+		words := make([]string, 0, len(rule.Keywords))
+		for _, v := range rule.Keywords {
+			if v = strings.TrimSpace(v); v != "" {
+				words = append(words, regexp.QuoteMeta(v))
+			}
+		}
+		if len(words) > 0 {
+			compiled.reg = append(compiled.reg, regexp.MustCompile(`(?i)\b(?:`+strings.Join(words, "|")+`)\b`))
+		}
+	}
+	if rule.Pattern != nil {
+		compiled.reg = append(compiled.reg, rule.Pattern)
+	}
+	engine.rules = append(engine.rules, compiled)
+}
+
+func (engine *RuleEngine) Check(ctx context.Context, text string) (*params.ModerationResult, error) {
+	res := newResult("rules", text)
+	action := ActionAllow
+	for _, rule := range engine.rules {
+		matched := false
+		for _, reg := range rule.reg {
+			if !reg.MatchString(res.Text) {
+				continue
+			}
+			matched = true
+			if rule.Action == ActionRedact {
+				res.Text = reg.ReplaceAllString(res.Text, engine.replacement)
+			}
+		}
+		if !matched {
+			continue
+		}
+		res.Flagged = true
+		res.Categories = append(res.Categories, rule.Name)
+		if rule.Action > action {
+			action = rule.Action
+		}
+	}
+	res.Action = action.String()
+	return res, nil
+}
@@ -1,12 +1,53 @@
 package params
 
+import "time"
+
+// finish reason of an answer stopped by the caller
+const FinishReasonStopped = "stopped"
+
 type Answer struct {
-	MsgId      string // message id: chatgptuno id,
-	ParentId   string
-	Chunk      string
-	Text       string
+	MsgId    string // message id: chatgptuno id,
+	ParentId string
+	Chunk    string
+	Text     string
+	// Chunk is the whole text and replaces every chunk sent before, the backend or output
+	// moderation rewrote text that was already streamed
+	Reset      bool
 	Done       bool
 	ChunkIndex int
+	Moderation []*ModerationResult // flagged, redacted or blocked moderation results of the prompt and output
+	Citations  []*Citation         // passages injected as context by a retriever
+	// candidates of a non-streamed answer with n > 1, ChoiceIndex is the one kept in the history
+	Candidates  []string
+	ChoiceIndex int
+	// why the answer ended, set when Done: stop, length, content_filter, stopped, empty when unknown
+	FinishReason string
+
+	Role           string        // assistant
+	Model          string        // model slug that answered
+	Backend        string        // chatgpt or chatgptuno
+	ConversationId string        // chatgptuno conversation id, empty for chatgpt
+	FirstToken     time.Duration // from sending the request to the first chunk
+	Elapsed        time.Duration // from sending the request to this answer
+	Usage          *Usage        // set when Done
+}
+
+// token usage of an answer
+type Usage struct {
+	PromptTokens     int
+	CompletionTokens int
+	TotalTokens      int
+	Estimated        bool // estimated by the client, the backend reported no usage
+}
+
+// usage estimated from token counts
+func EstimatedUsage(promptTokens, completionTokens int) *Usage {
+	return &Usage{
+		PromptTokens:     promptTokens,
+		CompletionTokens: completionTokens,
+		TotalTokens:      promptTokens + completionTokens,
+		Estimated:        true,
+	}
 }
 
 // create params for ask callback
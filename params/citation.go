@@ -0,0 +1,10 @@
+package params
+
+// a retrieved passage injected as context, the answer refers to it as [Index]
+type Citation struct {
+	Index  int
+	Source string // file path or url
+	Title  string
+	Text   string
+	Score  float32
+}
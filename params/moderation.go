@@ -0,0 +1,11 @@
+package params
+
+// result of a moderation check, reported in Answer.Moderation
+type ModerationResult struct {
+	Stage      string   // prompt or output
+	Source     string   // who checked: openai, rules
+	Action     string   // allow, flag, redact, block
+	Flagged    bool     // whether anything matched
+	Categories []string // matched categories or rule names
+	Text       string   // checked text, redacted when Action is redact
+}
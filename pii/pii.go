@@ -0,0 +1,236 @@
+package pii
+
+import (
+	"container/list"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// a kind of PII, Validate filters false positives of Pattern
+type Detector struct {
+	Kind     string // placeholder name: [EMAIL_1]
+	Pattern  *regexp.Regexp
+	Validate func(match string) bool
+}
+
+var (
+	APIKeyDetector = Detector{
+		Kind:    "API_KEY",
+		Pattern: regexp.MustCompile(`\b(?:sk-[A-Za-z0-9_-]{20,}|AKIA[0-9A-Z]{16}|gh[pousr]_[A-Za-z0-9]{36,}|xox[abprs]-[A-Za-z0-9-]{10,}|AIza[0-9A-Za-z_-]{35})\b`),
+	}
+	CardDetector = Detector{
+		Kind:     "CARD",
+		Pattern:  regexp.MustCompile(`\b(?:\d[ -]?){12,18}\d\b`),
+		Validate: luhn,
+	}
+	EmailDetector = Detector{
+		Kind:    "EMAIL",
+		Pattern: regexp.MustCompile(`\b[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}\b`),
+	}
+	PhoneDetector = Detector{
+		Kind:     "PHONE",
+		Pattern:  regexp.MustCompile(`(?:\+\d{1,3}[ .-]?)?(?:\(\d{1,4}\)[ .-]?)?\d{2,4}(?:[ .-]?\d{2,4}){1,4}\b`),
+		Validate: phone,
+	}
+)
+
+// api keys, cards, emails, phones; the order matters, earlier detectors win
+func DefaultDetectors() []Detector {
+	return []Detector{APIKeyDetector, CardDetector, EmailDetector, PhoneDetector}
+}
+
+/*
+Redactor replaces PII with placeholders like [EMAIL_1] before a prompt leaves the process,
+the Vault remembers the original values to restore them in the answer.
+
+	redactor := pii.NewRedactor()
+	vault := pii.NewVault()
+	prompt = redactor.Redact(vault, "mail me at bob@example.com") // mail me at [EMAIL_1]
+	text := vault.Restore(answer)
+*/
+type Redactor struct {
+	detectors []Detector
+}
+
+// no detectors: DefaultDetectors()
+func NewRedactor(detectors ...Detector) *Redactor {
+	if len(detectors) == 0 {
+		detectors = DefaultDetectors()
+	}
+	return &Redactor{detectors: detectors}
+}
+
+func (r *Redactor) Redact(vault *Vault, text string) string {
+	for _, detector := range r.detectors {
+		text = detector.Pattern.ReplaceAllStringFunc(text, func(match string) string {
+			if placeholderReg.MatchString(match) {
+				return match
+			}
+			if detector.Validate != nil && !detector.Validate(match) {
+				return match
+			}
+			return vault.placeholder(detector.Kind, match)
+		})
+	}
+	return text
+}
+
+// vault begin ++++++++++++++++++++++++++++++++++++++++++++++++++++++++++++++
+
+var placeholderReg = regexp.MustCompile(`\[[A-Z][A-Z_]*_\d+\]`)
+
+/*
+Vault maps placeholders to original values, the same value always gets the same placeholder.
+It keeps the size most recently used values, an evicted placeholder is no longer restored
+and its value gets a new placeholder when it shows up again.
+*/
+type Vault struct {
+	size          int
+	byValue       map[string]string
+	byPlaceholder map[string]string
+	counter       map[string]int
+	order         *list.List               // placeholders, most recently used first
+	elems         map[string]*list.Element // by placeholder
+	sync.Mutex
+}
+
+// keeps 1000 values, see NewVaultSize
+func NewVault() *Vault {
+	return NewVaultSize(1000)
+}
+
+// size <= 0: 1000
+func NewVaultSize(size int) *Vault {
+	if size <= 0 {
+		size = 1000
+	}
+	return &Vault{
+		size:          size,
+		byValue:       make(map[string]string),
+		byPlaceholder: make(map[string]string),
+		counter:       make(map[string]int),
+		order:         list.New(),
+		elems:         make(map[string]*list.Element),
+	}
+}
+
+func (v *Vault) placeholder(kind, value string) string {
+	v.Lock()
+	defer v.Unlock()
+
+	if p, ok := v.byValue[value]; ok {
+		v.order.MoveToFront(v.elems[p])
+		return p
+	}
+	v.counter[kind]++
+	p := fmt.Sprintf("[%s_%d]", kind, v.counter[kind])
+	v.byValue[value] = p
+	v.byPlaceholder[p] = value
+	v.elems[p] = v.order.PushFront(p)
+	for v.order.Len() > v.size {
+		oldest := v.order.Remove(v.order.Back()).(string)
+		delete(v.byValue, v.byPlaceholder[oldest])
+		delete(v.byPlaceholder, oldest)
+		delete(v.elems, oldest)
+	}
+	return p
+}
+
+func (v *Vault) Len() int {
+	v.Lock()
+	defer v.Unlock()
+
+	return len(v.byPlaceholder)
+}
+
+// replace known placeholders with the original values
+func (v *Vault) Restore(text string) string {
+	v.Lock()
+	defer v.Unlock()
+
+	if len(v.byPlaceholder) == 0 {
+		return text
+	}
+	return placeholderReg.ReplaceAllStringFunc(text, func(p string) string {
+		if value, ok := v.byPlaceholder[p]; ok {
+			v.order.MoveToFront(v.elems[p])
+			return value
+		}
+		return p
+	})
+}
+
+/*
+Restore a streamed text that may end in the middle of a placeholder,
+the unfinished placeholder is held back until the next chunk completes it.
+*/
+func (v *Vault) RestorePartial(text string) string {
+	if i := strings.LastIndex(text, "["); i >= 0 && !strings.Contains(text[i:], "]") && partialReg.MatchString(text[i:]) {
+		text = text[:i]
+	}
+	return v.Restore(text)
+}
+
+var partialReg = regexp.MustCompile(`^\[(?:[A-Z][A-Z_]*(?:\d+)?)?$`)
+
+// vault end ----------------------------------------------------------------
+
+func digits(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if r >= '0' && r <= '9' {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// card number checksum
+func luhn(match string) bool {
+	number := digits(match)
+	if len(number) < 13 || len(number) > 19 {
+		return false
+	}
+	var sum int
+	double := false
+	for i := len(number) - 1; i >= 0; i-- {
+		d := int(number[i] - '0')
+		if double {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		double = !double
+	}
+	return sum%10 == 0
+}
+
+var (
+	isoDateReg    = regexp.MustCompile(`^\d{4}-\d{2}-\d{2}`)
+	digitGroupReg = regexp.MustCompile(`\d+`)
+)
+
+// 8-15 digits with a leading + or an (area) group, or 10-15 digits in groups of 3-4.
+// Dates, versions and order numbers are not phones.
+func phone(match string) bool {
+	n := len(digits(match))
+	if n < 8 || n > 15 || isoDateReg.MatchString(match) {
+		return false
+	}
+	if strings.HasPrefix(match, "+") || strings.Contains(match, "(") {
+		return true
+	}
+	if n < 10 {
+		return false
+	}
+	for _, group := range digitGroupReg.FindAllString(match, -1) {
+		if len(group) < 3 || len(group) > 4 {
+			return false
+		}
+	}
+	return true
+}
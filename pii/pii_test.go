@@ -0,0 +1,88 @@
+package pii
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRedactRestore(t *testing.T) {
+	tests := []struct {
+		name     string
+		in       string
+		redacted string
+	}{
+		{"email", "mail bob@example.com please", "mail [EMAIL_1] please"},
+		{"same value same placeholder", "bob@example.com or bob@example.com", "[EMAIL_1] or [EMAIL_1]"},
+		{"api key", "key sk-abcdefghijklmnopqrstuvwx", "key [API_KEY_1]"},
+		{"card", "card 4111 1111 1111 1111", "card [CARD_1]"},
+		{"not a card", "order 1234 5678 9012 3456", "order 1234 5678 9012 3456"},
+		{"phone", "call +1 415 555 2671", "call [PHONE_1]"},
+		{"phone with area", "call (02) 9876 5432", "call [PHONE_1]"},
+		{"phone in groups", "call 415-555-2671", "call [PHONE_1]"},
+		{"date", "released 2023-10-19", "released 2023-10-19"},
+		{"date and time", "at 2023-10-19 1230", "at 2023-10-19 1230"},
+		{"version", "version 10.20.30.40", "version 10.20.30.40"},
+		{"order number", "order 20231019001", "order 20231019001"},
+		{"short groups", "order 12-3456-789", "order 12-3456-789"},
+		{"placeholder kept", "see [EMAIL_1]", "see [EMAIL_1]"},
+		{"nothing", "hello world", "hello world"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			vault := NewVault()
+			got := NewRedactor().Redact(vault, tt.in)
+			if got != tt.redacted {
+				t.Fatalf("Redact(%q) = %q, want %q", tt.in, got, tt.redacted)
+			}
+			if vault.Len() > 0 {
+				if restored := vault.Restore(got); restored != tt.in {
+					t.Errorf("Restore(%q) = %q, want %q", got, restored, tt.in)
+				}
+			}
+		})
+	}
+}
+
+func TestRestorePartial(t *testing.T) {
+	vault := NewVault()
+	NewRedactor().Redact(vault, "bob@example.com")
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"mail [EMAIL_1]", "mail bob@example.com"},
+		{"mail [EMA", "mail "},
+		{"mail [EMAIL_", "mail "},
+		{"mail [", "mail "},
+		{"list [a]", "list [a]"},
+		{"unknown [EMAIL_9]", "unknown [EMAIL_9]"},
+	}
+	for _, tt := range tests {
+		if got := vault.RestorePartial(tt.in); got != tt.want {
+			t.Errorf("RestorePartial(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestVaultSize(t *testing.T) {
+	vault := NewVaultSize(2)
+	redactor := NewRedactor(EmailDetector)
+	a := redactor.Redact(vault, "a@example.com")
+	redactor.Redact(vault, "b@example.com")
+	// a is used again and stays, b is evicted by c
+	redactor.Redact(vault, "a@example.com")
+	redactor.Redact(vault, "c@example.com")
+	if vault.Len() != 2 {
+		t.Fatalf("Len() = %d, want 2", vault.Len())
+	}
+	if got := vault.Restore(a); got != "a@example.com" {
+		t.Errorf("Restore(%q) = %q", a, got)
+	}
+	if got := vault.Restore("[EMAIL_2]"); got != "[EMAIL_2]" {
+		t.Errorf("evicted placeholder restored to %q", got)
+	}
+	// an evicted value gets a new placeholder
+	if got := redactor.Redact(vault, "b@example.com"); !strings.HasPrefix(got, "[EMAIL_4]") {
+		t.Errorf("Redact of evicted value = %q, want [EMAIL_4]", got)
+	}
+}
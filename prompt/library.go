@@ -0,0 +1,168 @@
+package prompt
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"text/template"
+)
+
+/*
+Library holds versioned templates loaded from a directory:
+
+	support.v1.tmpl, support.v2.tmpl  template "support" in version 1 and 2
+	_tone.tmpl                        partial, used as {{template "tone" .}}
+
+	lib, err := prompt.LoadDir("./prompts")
+	rendered, err := lib.Render("support", 0, map[string]interface{}{"product": "Acme", "question": q})
+	err = conversation.AskPrompt(ctx, rendered.System, rendered.User, callback)
+*/
+type Library struct {
+	partials  map[string]string
+	templates map[string]map[int]*Template
+	sync.RWMutex
+}
+
+func NewLibrary() *Library {
+	return &Library{
+		partials:  make(map[string]string),
+		templates: make(map[string]map[int]*Template),
+	}
+}
+
+// load all *.tmpl files of dir
+func LoadDir(dir string) (*Library, error) {
+	return LoadFS(os.DirFS(dir), ".")
+}
+
+// load all *.tmpl files of dir in fsys, e.g. an embed.FS
+func LoadFS(fsys fs.FS, dir string) (*Library, error) {
+	files, err := fs.Glob(fsys, path.Join(dir, "*.tmpl"))
+	if err != nil {
+		return nil, err
+	}
+	lib := NewLibrary()
+	// partials first, templates are parsed with all of them
+	sort.Slice(files, func(i, j int) bool {
+		pi, pj := strings.HasPrefix(path.Base(files[i]), "_"), strings.HasPrefix(path.Base(files[j]), "_")
+		if pi != pj {
+			return pi
+		}
+		return files[i] < files[j]
+	})
+	for _, file := range files {
+		b, err := fs.ReadFile(fsys, file)
+		if err != nil {
+			return nil, err
+		}
+		base := path.Base(file)
+		if strings.HasPrefix(base, "_") {
+			if err := lib.AddPartial(strings.TrimSuffix(strings.TrimPrefix(base, "_"), ".tmpl"), string(b)); err != nil {
+				return nil, fmt.Errorf("%s: %s", file, err.Error())
+			}
+			continue
+		}
+		name, version, ok := parseFileName(base)
+		if !ok {
+			continue
+		}
+		if _, err := lib.Add(name, version, string(b)); err != nil {
+			return nil, fmt.Errorf("%s: %s", file, err.Error())
+		}
+	}
+	return lib, nil
+}
+
+// add a partial, only templates added afterwards can use it. A partial name is added once.
+func (lib *Library) AddPartial(name, text string) error {
+	lib.Lock()
+	defer lib.Unlock()
+
+	if _, ok := lib.partials[name]; ok {
+		return fmt.Errorf("partial %s already added", name)
+	}
+	lib.partials[name] = text
+	return nil
+}
+
+// parse and add a template with optional front matter, an existing version is replaced
+func (lib *Library) Add(name string, version int, text string) (*Template, error) {
+	if name == "" || version <= 0 {
+		return nil, fmt.Errorf("invalid template name %q or version %d", name, version)
+	}
+	vars, body, typed, err := parseFrontMatter(text)
+	if err != nil {
+		return nil, err
+	}
+	lib.Lock()
+	defer lib.Unlock()
+
+	tmpl, err := template.New(name).Funcs(funcs).Option("missingkey=error").Parse(body)
+	if err != nil {
+		return nil, err
+	}
+	for partial, text := range lib.partials {
+		// the template, its blocks and other partials are not replaced
+		if tmpl.Lookup(partial) != nil {
+			return nil, fmt.Errorf("partial %s has the name of a template or block", partial)
+		}
+		if _, err := tmpl.New(partial).Parse(text); err != nil {
+			return nil, fmt.Errorf("partial %s: %s", partial, err.Error())
+		}
+	}
+	t := &Template{Name: name, Version: version, Vars: vars, typed: typed, tmpl: tmpl}
+	if lib.templates[name] == nil {
+		lib.templates[name] = make(map[int]*Template)
+	}
+	lib.templates[name][version] = t
+	return t, nil
+}
+
+// get a template, version 0: the latest version
+func (lib *Library) Get(name string, version int) (*Template, error) {
+	lib.RLock()
+	defer lib.RUnlock()
+
+	versions := lib.templates[name]
+	if len(versions) == 0 {
+		return nil, fmt.Errorf("template %s not found", name)
+	}
+	if version == 0 {
+		for v := range versions {
+			if v > version {
+				version = v
+			}
+		}
+	}
+	t, ok := versions[version]
+	if !ok {
+		return nil, fmt.Errorf("template %s.v%d not found", name, version)
+	}
+	return t, nil
+}
+
+// versions of a template in ascending order
+func (lib *Library) Versions(name string) []int {
+	lib.RLock()
+	defer lib.RUnlock()
+
+	var versions []int
+	for v := range lib.templates[name] {
+		versions = append(versions, v)
+	}
+	sort.Ints(versions)
+	return versions
+}
+
+// render a template, version 0: the latest version
+func (lib *Library) Render(name string, version int, vars map[string]interface{}) (*Rendered, error) {
+	t, err := lib.Get(name, version)
+	if err != nil {
+		return nil, err
+	}
+	return t.Render(vars)
+}
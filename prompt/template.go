@@ -0,0 +1,294 @@
+package prompt
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+// variable types of the front matter
+const (
+	TypeString = "string"
+	TypeInt    = "int"
+	TypeFloat  = "float"
+	TypeBool   = "bool"
+	TypeList   = "list" // []string
+)
+
+// a typed template variable, a variable without default is required
+type Var struct {
+	Name       string
+	Type       string
+	Default    interface{}
+	HasDefault bool
+}
+
+// a parsed template, Name and Version come from the file name name.vN.tmpl
+type Template struct {
+	Name    string
+	Version int
+	Vars    []*Var
+	typed   bool // has front matter, only declared variables are accepted
+	tmpl    *template.Template
+}
+
+// the system message and user prompt of an Ask
+type Rendered struct {
+	System string
+	User   string
+}
+
+var funcs = template.FuncMap{
+	"join":  strings.Join,
+	"upper": strings.ToUpper,
+	"lower": strings.ToLower,
+	"trim":  strings.TrimSpace,
+}
+
+/*
+front matter between --- lines declares the variables, found is false without front matter:
+
+	---
+	product: string
+	question: string
+	max_words: int = 100
+	topics: list = billing, login
+	---
+	{{define "system"}}You are the support bot of {{.product}}. {{template "tone" .}}{{end}}
+	{{define "user"}}Answer in at most {{.max_words}} words: {{.question}}{{end}}
+*/
+func parseFrontMatter(text string) (vars []*Var, body string, found bool, err error) {
+	if !strings.HasPrefix(text, "---\n") && !strings.HasPrefix(text, "---\r\n") {
+		return nil, text, false, nil
+	}
+	lines := strings.SplitAfter(text, "\n")
+	for i := 1; i < len(lines); i++ {
+		line := strings.TrimSpace(lines[i])
+		if line == "---" {
+			return vars, strings.Join(lines[i+1:], ""), true, nil
+		}
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		v, err := parseVar(line)
+		if err != nil {
+			return nil, "", true, fmt.Errorf("front matter line %d: %s", i+1, err.Error())
+		}
+		vars = append(vars, v)
+	}
+	return nil, "", true, fmt.Errorf("front matter is not closed by ---")
+}
+
+// name: type [= default]
+func parseVar(line string) (*Var, error) {
+	name, decl, ok := strings.Cut(line, ":")
+	if !ok {
+		return nil, fmt.Errorf("want name: type, got %q", line)
+	}
+	v := &Var{Name: strings.TrimSpace(name)}
+	typ, def, hasDefault := strings.Cut(decl, "=")
+	v.Type = strings.TrimSpace(typ)
+	switch v.Type {
+	case TypeString, TypeInt, TypeFloat, TypeBool, TypeList:
+	default:
+		return nil, fmt.Errorf("unknown type %q of %s", v.Type, v.Name)
+	}
+	if hasDefault {
+		value, err := parseValue(v.Type, strings.TrimSpace(def))
+		if err != nil {
+			return nil, fmt.Errorf("default of %s: %s", v.Name, err.Error())
+		}
+		v.Default = value
+		v.HasDefault = true
+	}
+	return v, nil
+}
+
+func parseValue(typ, s string) (interface{}, error) {
+	switch typ {
+	case TypeInt:
+		return strconv.Atoi(s)
+	case TypeFloat:
+		return strconv.ParseFloat(s, 64)
+	case TypeBool:
+		return strconv.ParseBool(s)
+	case TypeList:
+		var list []string
+		for _, v := range strings.Split(s, ",") {
+			if v = strings.TrimSpace(v); v != "" {
+				list = append(list, v)
+			}
+		}
+		return list, nil
+	default:
+		return strings.Trim(s, `"`), nil
+	}
+}
+
+// convert a value to the declared type
+func convert(v *Var, value interface{}) (interface{}, error) {
+	switch v.Type {
+	case TypeString:
+		if s, ok := value.(string); ok {
+			return s, nil
+		}
+		if s, ok := value.(fmt.Stringer); ok {
+			return s.String(), nil
+		}
+	case TypeInt:
+		switch n := value.(type) {
+		case int:
+			return n, nil
+		case int8:
+			return int(n), nil
+		case int16:
+			return int(n), nil
+		case int32:
+			return int(n), nil
+		case int64:
+			return int(n), nil
+		case uint:
+			return int(n), nil
+		case uint8:
+			return int(n), nil
+		case uint16:
+			return int(n), nil
+		case uint32:
+			return int(n), nil
+		case float64:
+			if n == float64(int(n)) {
+				return int(n), nil
+			}
+		}
+	case TypeFloat:
+		switch n := value.(type) {
+		case float64:
+			return n, nil
+		case float32:
+			return float64(n), nil
+		case int:
+			return float64(n), nil
+		case int64:
+			return float64(n), nil
+		}
+	case TypeBool:
+		if b, ok := value.(bool); ok {
+			return b, nil
+		}
+	case TypeList:
+		switch list := value.(type) {
+		case []string:
+			return list, nil
+		case []interface{}:
+			out := make([]string, len(list))
+			for i, item := range list {
+				s, ok := item.(string)
+				if !ok {
+					return nil, fmt.Errorf("variable %s: item %d is %T, want string", v.Name, i, item)
+				}
+				out[i] = s
+			}
+			return out, nil
+		}
+	}
+	return nil, fmt.Errorf("variable %s is %T, want %s", v.Name, value, v.Type)
+}
+
+/*
+check vars against the declared variables and fill defaults. With front matter undeclared
+variables are an error, without front matter every variable is passed untyped.
+*/
+func (t *Template) bind(vars map[string]interface{}) (map[string]interface{}, error) {
+	data := make(map[string]interface{}, len(t.Vars))
+	declared := make(map[string]bool, len(t.Vars))
+	for _, v := range t.Vars {
+		declared[v.Name] = true
+		value, ok := vars[v.Name]
+		if !ok {
+			if !v.HasDefault {
+				return nil, fmt.Errorf("template %s.v%d: missing variable %s", t.Name, t.Version, v.Name)
+			}
+			data[v.Name] = v.Default
+			continue
+		}
+		value, err := convert(v, value)
+		if err != nil {
+			return nil, fmt.Errorf("template %s.v%d: %s", t.Name, t.Version, err.Error())
+		}
+		data[v.Name] = value
+	}
+	var unknown []string
+	for name, value := range vars {
+		if declared[name] {
+			continue
+		}
+		if !t.typed {
+			data[name] = value
+			continue
+		}
+		unknown = append(unknown, name)
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return nil, fmt.Errorf("template %s.v%d: undeclared variables %s", t.Name, t.Version, strings.Join(unknown, ", "))
+	}
+	return data, nil
+}
+
+func (t *Template) execute(name string, data map[string]interface{}) (string, error) {
+	var b bytes.Buffer
+	if err := t.tmpl.ExecuteTemplate(&b, name, data); err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(b.String()), nil
+}
+
+/*
+render the "system" and "user" blocks of the template,
+a template without blocks renders its whole body as the user prompt.
+*/
+func (t *Template) Render(vars map[string]interface{}) (*Rendered, error) {
+	data, err := t.bind(vars)
+	if err != nil {
+		return nil, err
+	}
+	rendered := &Rendered{}
+	hasBlock := false
+	if t.tmpl.Lookup("system") != nil {
+		hasBlock = true
+		if rendered.System, err = t.execute("system", data); err != nil {
+			return nil, err
+		}
+	}
+	if t.tmpl.Lookup("user") != nil {
+		hasBlock = true
+		if rendered.User, err = t.execute("user", data); err != nil {
+			return nil, err
+		}
+	}
+	if !hasBlock {
+		if rendered.User, err = t.execute(t.tmpl.Name(), data); err != nil {
+			return nil, err
+		}
+	}
+	return rendered, nil
+}
+
+// name.vN.tmpl, a file without version is version 1
+var fileName = regexp.MustCompile(`^(.+?)(?:\.v(\d+))?\.tmpl$`)
+
+func parseFileName(file string) (string, int, bool) {
+	m := fileName.FindStringSubmatch(file)
+	if m == nil {
+		return "", 0, false
+	}
+	version := 1
+	if m[2] != "" {
+		version, _ = strconv.Atoi(m[2])
+	}
+	return m[1], version, true
+}
@@ -0,0 +1,169 @@
+package prompt
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRender(t *testing.T) {
+	typed := `---
+product: string
+question: string
+max_words: int = 100
+topics: list = billing, login
+---
+{{define "system"}}You are the support bot of {{.product}}. {{template "tone" .}}{{end}}
+{{define "user"}}Answer in at most {{.max_words}} words about {{join .topics ", "}}: {{.question}}{{end}}
+`
+	tests := []struct {
+		name    string
+		text    string
+		vars    map[string]interface{}
+		system  string
+		user    string
+		wantErr string // substring of the error, "": no error
+	}{
+		{
+			name: "no front matter",
+			text: "Hello {{.name}}",
+			vars: map[string]interface{}{"name": "Bob"},
+			user: "Hello Bob",
+		},
+		{
+			name:    "no front matter missing variable",
+			text:    "Hello {{.name}}",
+			vars:    nil,
+			wantErr: "name",
+		},
+		{
+			name:   "front matter with defaults",
+			text:   typed,
+			vars:   map[string]interface{}{"product": "Acme", "question": "how?"},
+			system: "You are the support bot of Acme. Be brief.",
+			user:   "Answer in at most 100 words about billing, login: how?",
+		},
+		{
+			name:   "front matter converts values",
+			text:   typed,
+			vars:   map[string]interface{}{"product": "Acme", "question": "why?", "max_words": float64(20), "topics": []interface{}{"api"}},
+			system: "You are the support bot of Acme. Be brief.",
+			user:   "Answer in at most 20 words about api: why?",
+		},
+		{
+			name:    "front matter missing variable",
+			text:    typed,
+			vars:    map[string]interface{}{"product": "Acme"},
+			wantErr: "missing variable question",
+		},
+		{
+			name:    "front matter undeclared variable",
+			text:    typed,
+			vars:    map[string]interface{}{"product": "Acme", "question": "q", "extra": 1},
+			wantErr: "undeclared variables extra",
+		},
+		{
+			name:    "front matter wrong type",
+			text:    typed,
+			vars:    map[string]interface{}{"product": "Acme", "question": "q", "max_words": "many"},
+			wantErr: "want int",
+		},
+		{
+			name:    "empty front matter is strict",
+			text:    "---\n---\nHello",
+			vars:    map[string]interface{}{"name": "Bob"},
+			wantErr: "undeclared variables name",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lib := NewLibrary()
+			lib.AddPartial("tone", "Be brief.")
+			if _, err := lib.Add("support", 1, tt.text); err != nil {
+				t.Fatalf("Add: %v", err)
+			}
+			rendered, err := lib.Render("support", 0, tt.vars)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Render err = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Render: %v", err)
+			}
+			if rendered.System != tt.system || rendered.User != tt.user {
+				t.Errorf("Render = %q / %q, want %q / %q", rendered.System, rendered.User, tt.system, tt.user)
+			}
+		})
+	}
+}
+
+func TestParseFrontMatter(t *testing.T) {
+	tests := []struct {
+		name    string
+		text    string
+		vars    int
+		found   bool
+		wantErr bool
+	}{
+		{"none", "Hello", 0, false, false},
+		{"vars", "---\na: string\nb: int = 3\n# comment\n---\nbody", 2, true, false},
+		{"crlf", "---\r\na: bool = true\r\n---\r\nbody", 1, true, false},
+		{"not closed", "---\na: string\n", 0, true, true},
+		{"unknown type", "---\na: map\n---\n", 0, true, true},
+		{"bad default", "---\na: int = x\n---\n", 0, true, true},
+		{"no type", "---\na\n---\n", 0, true, true},
+	}
+	for _, tt := range tests {
+		vars, _, found, err := parseFrontMatter(tt.text)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: err = %v, wantErr %v", tt.name, err, tt.wantErr)
+			continue
+		}
+		if len(vars) != tt.vars || found != tt.found {
+			t.Errorf("%s: %d vars found=%v, want %d found=%v", tt.name, len(vars), found, tt.vars, tt.found)
+		}
+	}
+}
+
+func TestParseFileName(t *testing.T) {
+	tests := []struct {
+		file    string
+		name    string
+		version int
+		ok      bool
+	}{
+		{"support.v2.tmpl", "support", 2, true},
+		{"support.tmpl", "support", 1, true},
+		{"a.b.v10.tmpl", "a.b", 10, true},
+		{"support.txt", "", 0, false},
+	}
+	for _, tt := range tests {
+		name, version, ok := parseFileName(tt.file)
+		if name != tt.name || version != tt.version || ok != tt.ok {
+			t.Errorf("parseFileName(%q) = %q %d %v", tt.file, name, version, ok)
+		}
+	}
+}
+
+func TestPartialNames(t *testing.T) {
+	lib := NewLibrary()
+	if err := lib.AddPartial("tone", "Be brief."); err != nil {
+		t.Fatal(err)
+	}
+	if err := lib.AddPartial("tone", "Be verbose."); err == nil {
+		t.Errorf("AddPartial of a repeated name succeeded")
+	}
+	if _, err := lib.Add("tone", 1, "Hello"); err == nil {
+		t.Errorf("Add of a template named like a partial succeeded")
+	}
+	if _, err := lib.Add("support", 1, `{{define "tone"}}Be kind.{{end}}{{template "tone"}}`); err == nil {
+		t.Errorf("Add of a block named like a partial succeeded")
+	}
+	if _, err := lib.Add("support", 1, `{{template "tone"}}`); err != nil {
+		t.Fatal(err)
+	}
+	if rendered, err := lib.Render("support", 0, nil); err != nil || rendered.User != "Be brief." {
+		t.Errorf("Render = %+v, %v", rendered, err)
+	}
+}
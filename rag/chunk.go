@@ -0,0 +1,123 @@
+package rag
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/billikeu/go-chatgpt/common"
+)
+
+// a chunk of a document, the unit of retrieval
+type Passage struct {
+	ID     string `json:"id"`
+	Source string `json:"source"`
+	Title  string `json:"title"`
+	Text   string `json:"text"`
+}
+
+/*
+Chunker splits documents into passages of about Size estimated tokens at paragraph boundaries,
+consecutive passages share Overlap tokens.
+*/
+type Chunker struct {
+	Size    int
+	Overlap int
+}
+
+func NewChunker(size, overlap int) *Chunker {
+	if size <= 0 {
+		size = 200
+	}
+	if overlap < 0 || overlap >= size {
+		overlap = 0
+	}
+	return &Chunker{Size: size, Overlap: overlap}
+}
+
+var paragraphSep = regexp.MustCompile(`\n\s*\n`)
+
+func (c *Chunker) Chunk(doc *Document) []*Passage {
+	var units []string
+	for _, paragraph := range paragraphSep.Split(doc.Text, -1) {
+		paragraph = strings.TrimSpace(paragraph)
+		if paragraph == "" {
+			continue
+		}
+		if common.EstimateTokens(paragraph) <= c.Size {
+			units = append(units, paragraph)
+			continue
+		}
+		units = append(units, c.splitWords(strings.Fields(paragraph))...)
+	}
+
+	var passages []*Passage
+	var current []string
+	var tokens, fresh int // fresh: units added after the overlap
+	flush := func() {
+		text := strings.Join(current, "\n\n")
+		passages = append(passages, &Passage{
+			ID:     fmt.Sprintf("%s#%d", doc.Source, len(passages)),
+			Source: doc.Source,
+			Title:  doc.Title,
+			Text:   text,
+		})
+		current, tokens, fresh = nil, 0, 0
+		if tail := c.tail(text); tail != "" {
+			current = []string{tail}
+			tokens = common.EstimateTokens(tail)
+		}
+	}
+	for _, unit := range units {
+		n := common.EstimateTokens(unit)
+		if tokens+n > c.Size && fresh > 0 {
+			flush()
+		}
+		current = append(current, unit)
+		tokens += n
+		fresh++
+	}
+	if fresh > 0 {
+		flush()
+	}
+	return passages
+}
+
+// split words into pieces of at most Size tokens
+func (c *Chunker) splitWords(words []string) []string {
+	var pieces []string
+	var piece []string
+	tokens := 0
+	for _, word := range words {
+		n := common.EstimateTokens(word) + 1
+		if tokens+n > c.Size && len(piece) > 0 {
+			pieces = append(pieces, strings.Join(piece, " "))
+			piece, tokens = nil, 0
+		}
+		piece = append(piece, word)
+		tokens += n
+	}
+	if len(piece) > 0 {
+		pieces = append(pieces, strings.Join(piece, " "))
+	}
+	return pieces
+}
+
+// the last Overlap tokens of text at word boundaries
+func (c *Chunker) tail(text string) string {
+	if c.Overlap == 0 {
+		return ""
+	}
+	words := strings.Fields(text)
+	tokens := 0
+	i := len(words)
+	for i > 0 {
+		n := common.EstimateTokens(words[i-1]) + 1
+		if tokens+n > c.Overlap {
+			break
+		}
+		tokens += n
+		i--
+	}
+	return strings.Join(words[i:], " ")
+}
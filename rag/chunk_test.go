@@ -0,0 +1,88 @@
+package rag
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/billikeu/go-chatgpt/common"
+)
+
+func TestNewChunker(t *testing.T) {
+	tests := []struct {
+		size, overlap         int
+		wantSize, wantOverlap int
+	}{
+		{0, 0, 200, 0},
+		{100, 20, 100, 20},
+		{100, 100, 100, 0},
+		{100, -1, 100, 0},
+	}
+	for _, tt := range tests {
+		c := NewChunker(tt.size, tt.overlap)
+		if c.Size != tt.wantSize || c.Overlap != tt.wantOverlap {
+			t.Errorf("NewChunker(%d, %d) = %+v", tt.size, tt.overlap, c)
+		}
+	}
+}
+
+func TestChunk(t *testing.T) {
+	paragraph := func(word string, n int) string {
+		return strings.TrimSpace(strings.Repeat(word+" ", n))
+	}
+	long := paragraph("long", 200)
+	tests := []struct {
+		name    string
+		size    int
+		overlap int
+		text    string
+		want    int // passages
+	}{
+		{"empty", 50, 0, "\n\n  \n\n", 0},
+		{"one paragraph", 50, 0, "Hello world.", 1},
+		{"paragraphs fit", 200, 0, paragraph("a", 10) + "\n\n" + paragraph("b", 10), 1},
+		{"paragraphs split", 10, 0, paragraph("a", 15) + "\n\n" + paragraph("b", 15) + "\n\n" + paragraph("c", 15), 3},
+		{"long paragraph", 50, 0, long, 0},
+	}
+	for _, tt := range tests {
+		c := NewChunker(tt.size, tt.overlap)
+		passages := c.Chunk(&Document{Source: "doc.md", Title: "Doc", Text: tt.text})
+		if tt.want > 0 && len(passages) != tt.want {
+			t.Errorf("%s: %d passages, want %d", tt.name, len(passages), tt.want)
+		}
+		for i, p := range passages {
+			if p.Source != "doc.md" || p.Title != "Doc" || p.ID != fmt.Sprintf("doc.md#%d", i) {
+				t.Errorf("%s: passage %d = %+v", tt.name, i, p)
+			}
+			if n := common.EstimateTokens(p.Text); n > tt.size+tt.overlap+1 {
+				t.Errorf("%s: passage %d has %d tokens, size %d", tt.name, i, n, tt.size)
+			}
+		}
+		if tt.name == "long paragraph" {
+			// split at words, nothing lost
+			var words []string
+			for _, p := range passages {
+				words = append(words, strings.Fields(p.Text)...)
+			}
+			if len(passages) < 2 || strings.Join(words, " ") != long {
+				t.Errorf("%s: %d passages lose words", tt.name, len(passages))
+			}
+		}
+	}
+}
+
+func TestChunkOverlap(t *testing.T) {
+	text := "alpha beta gamma delta\n\nepsilon zeta eta theta\n\niota kappa lambda mu"
+	// a passage has room for a paragraph and a one word overlap
+	c := NewChunker(common.EstimateTokens("alpha beta gamma delta")+2, 4)
+	passages := c.Chunk(&Document{Source: "greek.txt", Text: text})
+	if len(passages) < 2 {
+		t.Fatalf("%d passages", len(passages))
+	}
+	for i := 1; i < len(passages); i++ {
+		prev := strings.Fields(passages[i-1].Text)
+		if first := strings.Fields(passages[i].Text)[0]; first != prev[len(prev)-1] {
+			t.Errorf("passage %d %q does not start with the end of %q", i, passages[i].Text, passages[i-1].Text)
+		}
+	}
+}
@@ -0,0 +1,147 @@
+package rag
+
+import (
+	"bytes"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// a source document, Text is plain text or markdown
+type Document struct {
+	Source string
+	Title  string
+	Text   string
+}
+
+// supported file extensions
+var extensions = map[string]string{
+	".md":       "markdown",
+	".markdown": "markdown",
+	".txt":      "text",
+	".html":     "html",
+	".htm":      "html",
+}
+
+// load a markdown, text or html file
+func LoadFile(path string) (*Document, error) {
+	format, ok := extensions[strings.ToLower(filepath.Ext(path))]
+	if !ok {
+		return nil, fmt.Errorf("unsupported document type: %s", path)
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var doc *Document
+	switch format {
+	case "markdown":
+		doc = ParseMarkdown(string(b))
+	case "html":
+		doc, err = ParseHTML(b)
+		if err != nil {
+			return nil, fmt.Errorf("parse %s err:%s", path, err.Error())
+		}
+	default:
+		doc = &Document{Text: string(b)}
+	}
+	doc.Source = path
+	if doc.Title == "" {
+		doc.Title = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	}
+	return doc, nil
+}
+
+// load all supported files under dir, other files are skipped
+func LoadDir(dir string) ([]*Document, error) {
+	var docs []*Document
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		if _, ok := extensions[strings.ToLower(filepath.Ext(path))]; !ok {
+			return nil
+		}
+		doc, err := LoadFile(path)
+		if err != nil {
+			return err
+		}
+		docs = append(docs, doc)
+		return nil
+	})
+	return docs, err
+}
+
+// markdown is kept as it is, the first heading is the title
+func ParseMarkdown(text string) *Document {
+	doc := &Document{Text: text}
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "#") {
+			doc.Title = strings.TrimSpace(strings.TrimLeft(line, "#"))
+			break
+		}
+	}
+	return doc
+}
+
+// skipped html elements
+var skipElements = map[string]bool{
+	"script":   true,
+	"style":    true,
+	"noscript": true,
+	"template": true,
+	"title":    true,
+}
+
+// block elements end a paragraph
+var blockElements = map[string]bool{
+	"p": true, "div": true, "br": true, "li": true, "tr": true, "table": true,
+	"h1": true, "h2": true, "h3": true, "h4": true, "h5": true, "h6": true,
+	"pre": true, "blockquote": true, "section": true, "article": true, "ul": true, "ol": true,
+}
+
+// extract the visible text and title of a html page
+func ParseHTML(b []byte) (*Document, error) {
+	root, err := html.Parse(bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+	doc := &Document{}
+	var text strings.Builder
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode {
+			if n.Data == "title" && doc.Title == "" && n.FirstChild != nil {
+				doc.Title = strings.TrimSpace(n.FirstChild.Data)
+			}
+			if skipElements[n.Data] {
+				return
+			}
+		}
+		if n.Type == html.TextNode {
+			if s := strings.Join(strings.Fields(n.Data), " "); s != "" {
+				if text.Len() > 0 && !strings.HasSuffix(text.String(), "\n") {
+					text.WriteByte(' ')
+				}
+				text.WriteString(s)
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+		if n.Type == html.ElementNode && blockElements[n.Data] && !strings.HasSuffix(text.String(), "\n\n") && text.Len() > 0 {
+			text.WriteString("\n\n")
+		}
+	}
+	walk(root)
+	doc.Text = strings.TrimSpace(text.String())
+	return doc, nil
+}
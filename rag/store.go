@@ -0,0 +1,134 @@
+package rag
+
+import (
+	"context"
+	"errors"
+
+	"github.com/billikeu/go-chatgpt/params"
+	"github.com/billikeu/go-chatgpt/vector"
+)
+
+// turns texts into embedding vectors, chatgpt.EmbeddingClient and chatgpt.ChatGPTConversion implement it
+type Embedder interface {
+	Embed(ctx context.Context, inputs []string) ([][]float32, error)
+}
+
+/*
+Store chunks and embeds documents into a local vector index and retrieves the passages closest to a query.
+
+	client := chatgpt.NewEmbeddingClient("sk-...")
+	client.Init()
+	store := rag.NewStore(client)
+	docs, err := rag.LoadDir("./docs")
+	err = store.Add(ctx, docs...)
+	err = store.Save("./docs.index.json")
+	conversation.SetRetriever(store, 4)
+*/
+type Store struct {
+	embedder Embedder
+	chunker  *Chunker
+	index    *vector.Index[*Passage]
+	minScore float32
+}
+
+func NewStore(embedder Embedder) *Store {
+	return &Store{
+		embedder: embedder,
+		chunker:  NewChunker(200, 20),
+		index:    vector.NewIndex[*Passage](),
+	}
+}
+
+// set chunker of Add, default 200 tokens with 20 tokens overlap
+func (s *Store) SetChunker(chunker *Chunker) {
+	if chunker != nil {
+		s.chunker = chunker
+	}
+}
+
+// passages below the cosine similarity are not retrieved, default 0
+func (s *Store) SetMinScore(minScore float32) {
+	s.minScore = minScore
+}
+
+// chunk, embed and index documents, the passages of an already indexed source are replaced
+func (s *Store) Add(ctx context.Context, docs ...*Document) error {
+	for _, doc := range docs {
+		passages := s.chunker.Chunk(doc)
+		texts := make([]string, len(passages))
+		for i, v := range passages {
+			texts[i] = v.Title + "\n\n" + v.Text
+		}
+		vectors, err := s.embedder.Embed(ctx, texts)
+		if err != nil {
+			return err
+		}
+		if len(vectors) != len(passages) {
+			return errors.New("embeddings count does not match passages")
+		}
+		s.Remove(doc.Source)
+		for i, v := range passages {
+			s.index.Add(v.ID, vectors[i], v)
+		}
+	}
+	return nil
+}
+
+// load and add all supported files under dir
+func (s *Store) AddDir(ctx context.Context, dir string) error {
+	docs, err := LoadDir(dir)
+	if err != nil {
+		return err
+	}
+	return s.Add(ctx, docs...)
+}
+
+// remove the passages of source, return the removed count
+func (s *Store) Remove(source string) int {
+	return s.index.RemoveFunc(func(id string, passage *Passage) bool {
+		return passage.Source == source
+	})
+}
+
+// indexed passages
+func (s *Store) Len() int {
+	return s.index.Len()
+}
+
+// top k passages for query as citations numbered from 1
+func (s *Store) Retrieve(ctx context.Context, query string, k int) ([]*params.Citation, error) {
+	if s.index.Len() == 0 {
+		return nil, nil
+	}
+	vectors, err := s.embedder.Embed(ctx, []string{query})
+	if err != nil {
+		return nil, err
+	}
+	if len(vectors) != 1 {
+		return nil, errors.New("embeddings count does not match query")
+	}
+	var citations []*params.Citation
+	for _, v := range s.index.Search(vectors[0], k, nil) {
+		if v.Score < s.minScore {
+			break
+		}
+		citations = append(citations, &params.Citation{
+			Index:  len(citations) + 1,
+			Source: v.Payload.Source,
+			Title:  v.Payload.Title,
+			Text:   v.Payload.Text,
+			Score:  v.Score,
+		})
+	}
+	return citations, nil
+}
+
+// save the index to a json file
+func (s *Store) Save(path string) error {
+	return s.index.Save(path)
+}
+
+// load an index written by Save
+func (s *Store) Load(path string) error {
+	return s.index.Load(path)
+}
@@ -0,0 +1,194 @@
+package vector
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"os"
+	"sort"
+	"sync"
+)
+
+type item[T any] struct {
+	ID      string    `json:"id"`
+	Vector  []float32 `json:"vector"`
+	Payload T         `json:"payload"`
+}
+
+type Match[T any] struct {
+	ID      string
+	Score   float32 // cosine similarity
+	Payload T
+}
+
+/*
+Index is an embedded in-memory vector index searched by cosine similarity,
+it can be saved to and loaded from a json file.
+
+	index := vector.NewIndex[string]()
+	index.Add("doc-1", embedding, "some text")
+	matches := index.Search(query, 3, nil)
+*/
+type Index[T any] struct {
+	items map[string]*item[T]
+	sync.RWMutex
+}
+
+func NewIndex[T any]() *Index[T] {
+	return &Index[T]{items: make(map[string]*item[T])}
+}
+
+// add or replace an item, the vector is normalized
+func (idx *Index[T]) Add(id string, vector []float32, payload T) {
+	idx.Lock()
+	defer idx.Unlock()
+
+	idx.items[id] = &item[T]{ID: id, Vector: Normalize(vector), Payload: payload}
+}
+
+func (idx *Index[T]) Remove(id string) bool {
+	idx.Lock()
+	defer idx.Unlock()
+
+	_, ok := idx.items[id]
+	delete(idx.items, id)
+	return ok
+}
+
+// remove all items matched by fn, return the removed count
+func (idx *Index[T]) RemoveFunc(fn func(id string, payload T) bool) int {
+	idx.Lock()
+	defer idx.Unlock()
+
+	var n int
+	for id, v := range idx.items {
+		if fn(id, v.Payload) {
+			delete(idx.items, id)
+			n++
+		}
+	}
+	return n
+}
+
+func (idx *Index[T]) Get(id string) (T, bool) {
+	idx.RLock()
+	defer idx.RUnlock()
+
+	v, ok := idx.items[id]
+	if !ok {
+		var payload T
+		return payload, false
+	}
+	return v.Payload, true
+}
+
+func (idx *Index[T]) Len() int {
+	idx.RLock()
+	defer idx.RUnlock()
+
+	return len(idx.items)
+}
+
+// top k items by cosine similarity, filter == nil: all items
+func (idx *Index[T]) Search(vector []float32, k int, filter func(id string, payload T) bool) []Match[T] {
+	idx.RLock()
+	defer idx.RUnlock()
+
+	query := Normalize(vector)
+	matches := make([]Match[T], 0, k)
+	for _, v := range idx.items {
+		if filter != nil && !filter(v.ID, v.Payload) {
+			continue
+		}
+		if len(v.Vector) != len(query) {
+			continue
+		}
+		matches = append(matches, Match[T]{ID: v.ID, Score: dot(query, v.Vector), Payload: v.Payload})
+	}
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].Score == matches[j].Score {
+			return matches[i].ID < matches[j].ID
+		}
+		return matches[i].Score > matches[j].Score
+	})
+	if k > 0 && len(matches) > k {
+		matches = matches[:k]
+	}
+	return matches
+}
+
+// save all items to a json file
+func (idx *Index[T]) Save(path string) error {
+	idx.RLock()
+	items := make([]*item[T], 0, len(idx.items))
+	for _, v := range idx.items {
+		items = append(items, v)
+	}
+	idx.RUnlock()
+
+	sort.Slice(items, func(i, j int) bool { return items[i].ID < items[j].ID })
+	b, err := json.Marshal(items)
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, b, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// load items from a json file written by Save, existing items with the same id are replaced
+func (idx *Index[T]) Load(path string) error {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var items []*item[T]
+	if err := json.Unmarshal(b, &items); err != nil {
+		return err
+	}
+	idx.Lock()
+	defer idx.Unlock()
+
+	for _, v := range items {
+		if v.ID == "" {
+			return errors.New("vector index item without id")
+		}
+		idx.items[v.ID] = v
+	}
+	return nil
+}
+
+func dot(a, b []float32) float32 {
+	var sum float32
+	for i := range a {
+		sum += a[i] * b[i]
+	}
+	return sum
+}
+
+// scale v to unit length, a zero vector stays zero
+func Normalize(v []float32) []float32 {
+	var sum float64
+	for _, x := range v {
+		sum += float64(x) * float64(x)
+	}
+	out := make([]float32, len(v))
+	if sum == 0 {
+		return out
+	}
+	norm := float32(math.Sqrt(sum))
+	for i, x := range v {
+		out[i] = x / norm
+	}
+	return out
+}
+
+// cosine similarity of a and b, 0 when the lengths differ
+func Cosine(a, b []float32) float32 {
+	if len(a) != len(b) {
+		return 0
+	}
+	return dot(Normalize(a), Normalize(b))
+}
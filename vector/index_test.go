@@ -0,0 +1,88 @@
+package vector
+
+import (
+	"math"
+	"path/filepath"
+	"testing"
+)
+
+func TestNormalizeCosine(t *testing.T) {
+	tests := []struct {
+		a, b []float32
+		want float32
+	}{
+		{[]float32{1, 0}, []float32{2, 0}, 1},
+		{[]float32{1, 0}, []float32{0, 3}, 0},
+		{[]float32{1, 1}, []float32{-1, -1}, -1},
+		{[]float32{1, 0}, []float32{1, 1}, float32(math.Sqrt2 / 2)},
+		{[]float32{0, 0}, []float32{1, 0}, 0},
+		{[]float32{1, 0}, []float32{1, 0, 0}, 0},
+	}
+	for _, tt := range tests {
+		if got := Cosine(tt.a, tt.b); math.Abs(float64(got-tt.want)) > 1e-6 {
+			t.Errorf("Cosine(%v, %v) = %v, want %v", tt.a, tt.b, got, tt.want)
+		}
+	}
+	if n := Normalize([]float32{3, 4}); n[0] != 0.6 || n[1] != 0.8 {
+		t.Errorf("Normalize = %v", n)
+	}
+}
+
+func TestIndexSearch(t *testing.T) {
+	idx := NewIndex[string]()
+	idx.Add("east", []float32{1, 0}, "e")
+	idx.Add("north", []float32{0, 1}, "n")
+	idx.Add("north-east", []float32{1, 1}, "ne")
+	idx.Add("short", []float32{1}, "wrong dimension")
+
+	matches := idx.Search([]float32{2, 0.1}, 2, nil)
+	if len(matches) != 2 || matches[0].ID != "east" || matches[1].ID != "north-east" || matches[0].Payload != "e" {
+		t.Errorf("Search = %+v", matches)
+	}
+	matches = idx.Search([]float32{1, 0}, 0, func(id, payload string) bool { return payload != "e" })
+	if len(matches) != 2 || matches[0].ID != "north-east" || matches[1].ID != "north" {
+		t.Errorf("Search with filter = %+v", matches)
+	}
+
+	idx.Add("east", []float32{0, 1}, "moved")
+	if v, _ := idx.Get("east"); v != "moved" || idx.Len() != 4 {
+		t.Errorf("Add did not replace: %q, %d items", v, idx.Len())
+	}
+	if !idx.Remove("short") || idx.Remove("short") {
+		t.Errorf("Remove")
+	}
+	if n := idx.RemoveFunc(func(id, payload string) bool { return id != "north" }); n != 2 || idx.Len() != 1 {
+		t.Errorf("RemoveFunc removed %d, %d left", n, idx.Len())
+	}
+}
+
+func TestIndexSaveLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "index.json")
+	idx := NewIndex[map[string]string]()
+	idx.Add("a", []float32{1, 2, 3}, map[string]string{"source": "a.md"})
+	idx.Add("b", []float32{3, 2, 1}, map[string]string{"source": "b.md"})
+	if err := idx.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	loaded := NewIndex[map[string]string]()
+	loaded.Add("b", []float32{1, 0, 0}, nil)
+	if err := loaded.Load(path); err != nil {
+		t.Fatal(err)
+	}
+	if loaded.Len() != 2 {
+		t.Fatalf("loaded %d items", loaded.Len())
+	}
+	if v, _ := loaded.Get("b"); v["source"] != "b.md" {
+		t.Errorf("Load did not replace b: %v", v)
+	}
+	want := idx.Search([]float32{1, 1, 0}, 0, nil)
+	got := loaded.Search([]float32{1, 1, 0}, 0, nil)
+	for i := range want {
+		if got[i].ID != want[i].ID || got[i].Score != want[i].Score {
+			t.Errorf("match %d = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+	if err := loaded.Load(filepath.Join(t.TempDir(), "missing.json")); err == nil {
+		t.Errorf("Load of a missing file succeeded")
+	}
+}